@@ -1,26 +1,79 @@
 package main
 
 import (
+	"HTTPFTCP/internal/accesslog"
+	"HTTPFTCP/internal/compress"
+	"HTTPFTCP/internal/conditional"
+	"HTTPFTCP/internal/cors"
+	"HTTPFTCP/internal/loadshed"
+	"HTTPFTCP/internal/metrics"
+	"HTTPFTCP/internal/ratelimit"
 	"HTTPFTCP/internal/server"
+	"HTTPFTCP/internal/tracing"
 	"HTTPFTCP/internal/request"
 	"HTTPFTCP/internal/response"
-	"HTTPFTCP/internal/headers"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
-	"strings"
-	"net/http"
-	"io"
-	"crypto/sha256"
-	"encoding/hex"
-	"strconv"
+	"time"
 )
 
 const port = 42069
 
+// maxDecodedBodySize caps how large a compressed upload may expand to.
+const maxDecodedBodySize = 10 << 20
+
 func main() {
-    server, err := server.Serve(port, handler)
+	accessLogPath := flag.String("access-log", "", "write the access log to this file, rotated at 100MB or on SIGHUP, instead of stdout")
+	traceEndpoint := flag.String("trace-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), "send spans to this OTLP/HTTP traces URL, such as http://localhost:4318/v1/traces")
+	flag.Parse()
+
+	var accessLog io.Writer = os.Stdout
+	if *accessLogPath != "" {
+		rf, err := accesslog.OpenRotatingFile(*accessLogPath, 100<<20, 10)
+		if err != nil {
+			log.Fatalf("Error opening access log: %v", err)
+		}
+		defer rf.Close()
+		defer rf.RotateOnSignal(syscall.SIGHUP)()
+		accessLog = rf
+	}
+
+	var traceExporter tracing.Exporter
+	if *traceEndpoint != "" {
+		exp := tracing.NewOTLPExporter(tracing.OTLPOptions{Endpoint: *traceEndpoint, ServiceName: "httpserver"})
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			exp.Shutdown(ctx)
+		}()
+		traceExporter = exp
+	}
+
+	reg := metrics.NewRegistry()
+    server, err := server.ServeWithOptions(port, server.Chain(routes(reg).ServeRequest,
+		accesslog.Middleware(accesslog.Options{Logger: slog.New(accesslog.NewHandler(accessLog, accesslog.CombinedLog))}),
+		tracing.Middleware(tracing.Options{Exporter: traceExporter}),
+		loadshed.Middleware(loadshed.Options{MaxInFlight: 512, MaxLatency: 2 * time.Second}),
+		cors.Middleware(corsOptions),
+		ratelimit.Middleware(ratelimit.Options{Limiter: ratelimit.NewTokenBucket(100, time.Minute)}),
+		compress.Middleware(compress.Options{}),
+		compress.DecodeRequests(maxDecodedBodySize),
+	), server.Options{
+		MaxConns:       1024,
+		MaxConnsPerIP:  64,
+		RequestTimeout: time.Minute,
+		Metrics:        server.NewMetrics(reg),
+		ErrorHandler:   errorPage,
+	})
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -33,61 +86,47 @@ func main() {
 	log.Println("Server gracefully stopped")
 }
 
-func proxyHandler(w *response.Writer, req *request.Request) {
-	stripped := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := "https://httpbin.org/" + stripped
-
-	resp, err := http.Get(url); if err != nil {
-		handler500(w,req)
-		return
-	}
-	defer resp.Body.Close()
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	h := response.GetDefaultHeaders(0)
-	delete(h, "Content-Length")
-	h.Override("Transfer-Encoding", "chunked")
-	//State the trailers that will show up later
-	h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
-	w.WriteHeaders(h)
-
-	buf := make([]byte, 1024)
-	var fB []byte //keep track of bytes for SHA256 hash and length
-	for {
-    	n, err := resp.Body.Read(buf)
-    	if n > 0 {
-			fB = append(fB, buf[:n]...)
-        	if _, werr := w.WriteChunkedBody(buf[:n]); werr != nil {
-            	log.Println("error writing chunk:", werr)
-				break
-        	}
-    	}
-    	if err == io.EOF {
-        	break
-    	}
-    	if err != nil {
-        	break
-    	}
-	}
+// corsOptions lets frontends served from a local dev server call the API.
+var corsOptions = cors.Options{
+	AllowedOrigins: []string{"http://localhost:*", "http://127.0.0.1:*"},
+	AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+	AllowedHeaders: []string{"Content-Type", "Content-Encoding"},
+	ExposedHeaders: []string{"ETag"},
+	MaxAge:         10 * time.Minute,
+}
 
-	if _, err := w.WriteChunkedBodyDone(); err != nil {
-		log.Println("error finishing chunked body:", err)
-		return
+// routes registers every handler with the methods it serves. HEAD and
+// OPTIONS come for free from the Mux.
+func routes(reg *metrics.Registry) *server.Mux {
+	mux := server.NewMux()
+	mux.Handle("GET", "/metrics", metrics.Handler(reg))
+	mux.Handle("GET", "/admin/conns", localOnly(server.ConnsHandler))
+	mux.Handle("DELETE", "/admin/conns/", localOnly(server.ConnsHandler))
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		mux.Handle(method, "/httpbin/", cachedProxyHandler)
 	}
+	mux.Handle("GET", "/", conditionalPages)
+	mux.Handle("POST", "/", conditionalPages)
+	return mux
+}
 
-	//compute sha256 hash and length then write trailers
-	hash := sha256.Sum256(fB)
-	hexString := hex.EncodeToString(hash[:])
-	conLen := strconv.Itoa(len(fB))
-	trailers := headers.Headers{}
-	trailers["X-Content-SHA256"] = hexString
-	trailers["X-Content-Length"] = conLen
-
-	if err := w.WriteTrailers(trailers); err != nil {
-		log.Println("error finishing trailer/s", err)
+// localOnly hides h from everyone but clients on this machine.
+func localOnly(h server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		host, _, _ := net.SplitHostPort(req.RemoteAddr)
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			respondTo(w, req, response.StatusCodeNotFound, "<html><body><h1>Not Found</h1></body></html>", "Not Found")
+			return
+		}
+		h(w, req)
 	}
 }
 
-func handler(w *response.Writer, req *request.Request) {
+// conditionalPages gives the local pages ETags so clients can revalidate
+// them. Proxied responses keep the upstream's validators.
+var conditionalPages = conditional.Middleware(conditional.Options{})(pages)
+
+func pages(w *response.Writer, req *request.Request) {
 	
 	const badRequestHTML =     
 			`<html>
@@ -122,40 +161,73 @@ func handler(w *response.Writer, req *request.Request) {
   		</body>
 	</html>`
 
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-        proxyHandler(w, req)
-        return
-    }
-
 	if req.RequestLine.RequestTarget == "/yourproblem" {
-		w.WriteStatusLine(response.StatusCodeBadRequest)
-		body := []byte(badRequestHTML)
-		h := response.GetDefaultHeaders(len(body))
-		h.Override("Content-Type", "text/html")
-		w.WriteHeaders(h)
-		if _, err := w.WriteBody([]byte(badRequestHTML)); err != nil {
-    log.Println("write body error (400):", err)
-}
+		respondTo(w, req, response.StatusCodeBadRequest, badRequestHTML, "Your request honestly kinda sucked.")
 		return
 	}
 	if req.RequestLine.RequestTarget == "/myproblem" {
-		w.WriteStatusLine(response.StatusCodeInternalServerError)
-		body := []byte(internalServerErrHTML)
-		h := response.GetDefaultHeaders(len(body))
-		h.Override("Content-Type", "text/html")
-		w.WriteHeaders(h)
-		w.WriteBody([]byte(internalServerErrHTML))
+		respondTo(w, req, response.StatusCodeInternalServerError, internalServerErrHTML, "Okay, you know what? This one is on me.")
 		return
 	}
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	body := []byte(okHTML)
+	respondTo(w, req, response.StatusCodeSuccess, okHTML, "Your request was an absolute banger.")
+}
+
+// respondTo sends page to browsers and the same message as JSON to clients
+// that prefer it, or 406 to clients that accept neither.
+func respondTo(w *response.Writer, req *request.Request, statusCode response.StatusCode, page, message string) {
+	contentType, ok := req.Headers.Negotiate("text/html", "application/json")
+	if !ok {
+		respond(w, response.StatusCodeNotAcceptable, "text/plain", "Not Acceptable: try text/html or application/json", "")
+		return
+	}
+	respond(w, statusCode, contentType, page, message)
+}
+
+// respond sends message as JSON if contentType is application/json, and
+// page as it is otherwise.
+func respond(w *response.Writer, statusCode response.StatusCode, contentType, page, message string) {
+	body := []byte(page)
+	if contentType == "application/json" {
+		body, _ = json.Marshal(struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		}{int(statusCode), message})
+	}
+	w.WriteStatusLine(statusCode)
 	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
+	h.Override("Content-Type", contentType)
+	h.Override("Vary", "Accept")
 	w.WriteHeaders(h)
-	if _, err := w.WriteBody([]byte(okHTML)); err != nil {
-    log.Println("write body error (200):", err)
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("write body error (%d): %v", statusCode, err)
+	}
+}
+
+// errorPages are the messages for the errors the server answers itself.
+var errorPages = map[response.StatusCode]string{
+	response.StatusCodeBadRequest:          "Your request honestly kinda sucked.",
+	response.StatusCodeExpectationFailed:   "Whatever you were expecting, it isn't happening.",
+	response.StatusCodeInternalServerError: "Okay, you know what? This one is on me.",
+	response.StatusCodeVersionNotSupported: "We only speak HTTP/1.1 around here.",
+	response.StatusCodeServiceUnavailable:  "We're swamped. Give it a second and try again.",
 }
-	return
+
+// errorPage renders the server's own errors like the rest of the site.
+// Requests that couldn't be parsed, or that accept neither HTML nor JSON,
+// get HTML, since a 406 would hide what actually went wrong.
+func errorPage(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+	message, ok := errorPages[statusCode]
+	if !ok {
+		message = response.StatusText(statusCode)
+	}
+	page := fmt.Sprintf("<html><body><h1>%s</h1><p>%s</p></body></html>", response.StatusText(statusCode), message)
+	contentType := "text/html"
+	if req != nil {
+		if t, ok := req.Headers.Negotiate("text/html", "application/json"); ok {
+			contentType = t
+		}
+	}
+	respond(w, statusCode, contentType, page, message)
 }
 
 func handler500(w *response.Writer, _ *request.Request) {
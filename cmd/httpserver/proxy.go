@@ -0,0 +1,202 @@
+package main
+
+import (
+	"HTTPFTCP/internal/cache"
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+	"HTTPFTCP/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const upstreamTimeout = 30 * time.Second
+
+const proxyCacheSize = 64 << 20
+
+// upstreamBase is where /httpbin/ requests are sent.
+var upstreamBase = "https://httpbin.org/"
+
+// cachedProxyHandler is proxyHandler behind an in-memory HTTP cache.
+var cachedProxyHandler = cache.New(cache.NewMemoryStore(proxyCacheSize), cache.Options{}).Middleware(proxyHandler)
+
+var upstreamClient = &http.Client{
+	Timeout: upstreamTimeout,
+	// continue the request's trace, if it has one, upstream
+	Transport: &tracing.Transport{},
+	// relay redirects to our client instead of following them
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// relayedHeaders are the upstream response fields passed through to the
+// client. Framing and connection fields are ours to set.
+var relayedHeaders = []string{
+	"Content-Type",
+	"Content-Language",
+	"Cache-Control",
+	"Expires",
+	"ETag",
+	"Last-Modified",
+	"Age",
+	"Vary",
+	"Location",
+}
+
+// forwardedHeaders are the incoming request fields sent on to upstream.
+// Authorization and Cookie are left out: they are our client's credentials
+// for this server, not for a third-party host.
+var forwardedHeaders = []string{
+	"Content-Type",
+	"Accept",
+	"Accept-Language",
+	"If-None-Match",
+	"If-Modified-Since",
+	"User-Agent",
+}
+
+func proxyHandler(w *response.Writer, req *request.Request) {
+	stripped := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
+	url := upstreamBase + stripped
+
+	body, err := req.ReadBody()
+	if err != nil {
+		server.ServeError(w, req, server.ParseErrorStatus(err), err)
+		return
+	}
+	// stop pulling from upstream if our client goes away
+	upReq, err := http.NewRequestWithContext(req.Context(), req.RequestLine.Method, url, bytes.NewReader(body))
+	if err != nil {
+		handler500(w, req)
+		return
+	}
+	for _, k := range forwardedHeaders {
+		if v, ok := req.Headers.Get(k); ok {
+			upReq.Header.Set(k, v)
+		}
+	}
+
+	resp, err := upstreamClient.Do(upReq)
+	if err != nil {
+		if cause := context.Cause(req.Context()); cause == server.ErrClientDisconnected {
+			log.Printf("proxy: %v, abandoning %s", cause, url)
+			return
+		}
+		if isTimeout(err) {
+			handler504(w, req)
+		} else {
+			handler502(w, req)
+		}
+		return
+	}
+	defer resp.Body.Close()
+	tw, err := response.NewTrailerWriter(w, response.DigestSHA256)
+	if err != nil {
+		handler500(w, req)
+		return
+	}
+
+	code := response.StatusCode(resp.StatusCode)
+	reason := strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" ")
+	if err := w.WriteStatusLineWithReason(code, reason); err != nil {
+		w.WriteStatusLine(code)
+	}
+	h := upstreamHeaders(resp)
+	for _, c := range resp.Header.Values("Set-Cookie") {
+		w.AddHeaderLine("Set-Cookie", c)
+	}
+	if !hasBody(req, code) {
+		delete(h, "content-length")
+		w.WriteHeaders(h)
+		return
+	}
+	//State the trailers that will show up later
+	tw.DeclareTrailers(h)
+	w.WriteHeaders(h)
+
+	//the trailer writer hashes each chunk as it goes out
+	if _, err := io.CopyBuffer(tw, resp.Body, make([]byte, 1024)); err != nil {
+		log.Println("error writing chunk:", err)
+		if req.Context().Err() != nil {
+			// the client can't take the rest
+			return
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		log.Println("error finishing trailer/s", err)
+	}
+}
+
+// upstreamHeaders builds our response headers from the relayable fields of
+// resp, starting from the defaults.
+func upstreamHeaders(resp *http.Response) headers.Headers {
+	h := response.GetDefaultHeaders(0)
+	delete(h, "content-type")
+	for _, k := range relayedHeaders {
+		if vs := resp.Header.Values(k); len(vs) > 0 {
+			h.Override(k, strings.Join(vs, ", "))
+		}
+	}
+	return h
+}
+
+// hasBody reports whether a response with code to req carries a body.
+func hasBody(req *request.Request, code response.StatusCode) bool {
+	if req.RequestLine.Method == "HEAD" {
+		return false
+	}
+	return code >= 200 && code != response.StatusCodeNoContent && code != response.StatusCodeNotModified
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func handler502(w *response.Writer, _ *request.Request) {
+	const badGatewayHTML = `<html>
+<head>
+  <title>502 Bad Gateway</title>
+</head>
+<body>
+  <h1>Bad Gateway</h1>
+  <p>We couldn't reach the upstream server.</p>
+</body>
+</html>`
+
+	writeHTML(w, response.StatusCodeBadGateway, badGatewayHTML)
+}
+
+func handler504(w *response.Writer, _ *request.Request) {
+	const gatewayTimeoutHTML = `<html>
+<head>
+  <title>504 Gateway Timeout</title>
+</head>
+<body>
+  <h1>Gateway Timeout</h1>
+  <p>The upstream server took too long to answer.</p>
+</body>
+</html>`
+
+	writeHTML(w, response.StatusCodeGatewayTimeout, gatewayTimeoutHTML)
+}
+
+func writeHTML(w *response.Writer, statusCode response.StatusCode, page string) {
+	w.WriteStatusLine(statusCode)
+	body := []byte(page)
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/html")
+	w.WriteHeaders(h)
+	_, _ = w.WriteBody(body)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useUpstream points the proxy at url for the rest of the test.
+func useUpstream(t *testing.T, url string, timeout time.Duration) {
+	t.Helper()
+	base, client := upstreamBase, upstreamClient
+	t.Cleanup(func() { upstreamBase, upstreamClient = base, client })
+	upstreamBase = url + "/"
+	c := *client
+	c.Timeout = timeout
+	upstreamClient = &c
+}
+
+func proxy(target string, fields ...string) *response.Recorder {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	rec, w := response.NewRecorder()
+	proxyHandler(w, req)
+	return rec
+}
+
+func TestProxy(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+	useUpstream(t, upstream.URL, time.Second)
+
+	// Test: The path, and only the allowed request fields, go upstream
+	rec := proxy("/httpbin/anything?x=1", "Accept", "application/json", "Authorization", "Basic Zm9vOmJhcg==", "Cookie", "sid=abc")
+	r := <-got
+	assert.Equal(t, "/anything", r.URL.Path)
+	assert.Equal(t, "x=1", r.URL.RawQuery)
+	assert.Equal(t, "application/json", r.Header.Get("Accept"))
+	assert.Empty(t, r.Header.Get("Authorization"))
+	assert.Empty(t, r.Header.Get("Cookie"))
+
+	// Test: Status, allowed fields and the body are relayed, with trailers
+	assert.Equal(t, response.StatusCodeCreated, rec.StatusCode)
+	assert.Equal(t, "Created", rec.Reason)
+	assert.Equal(t, "application/json", rec.Headers["content-type"])
+	assert.Equal(t, `"v1"`, rec.Headers["etag"])
+	assert.NotContains(t, rec.Headers, "x-internal")
+	assert.Equal(t, "close", rec.Headers["connection"])
+	assert.Equal(t, `{"ok":true}`, rec.Body.String())
+	assert.True(t, rec.Chunked)
+	assert.Equal(t, "11", rec.Trailers["X-Content-Length"])
+
+	// Test: Each Set-Cookie is relayed on its own line
+	assert.Equal(t, []response.HeaderLine{
+		{Key: "Set-Cookie", Value: "a=1"},
+		{Key: "Set-Cookie", Value: "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT"},
+	}, rec.HeaderLines)
+}
+
+func TestProxyReason(t *testing.T) {
+	// a bare upstream, since net/http always sends the standard reason
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		c.Write([]byte("HTTP/1.1 299 Mostly Fine\r\nContent-Length: 0\r\n\r\n"))
+	}()
+	useUpstream(t, "http://"+l.Addr().String(), time.Second)
+
+	// Test: A non-standard reason phrase is passed through
+	rec := proxy("/httpbin/status/299")
+	assert.Equal(t, response.StatusCode(299), rec.StatusCode)
+	assert.Equal(t, "Mostly Fine", rec.Reason)
+}
+
+func TestProxyFailures(t *testing.T) {
+	// Test: An upstream that can't be reached is a 502
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	useUpstream(t, "http://"+addr, time.Second)
+	rec := proxy("/httpbin/get")
+	assert.Equal(t, response.StatusCodeBadGateway, rec.StatusCode)
+	assert.Contains(t, rec.Body.String(), "Bad Gateway")
+
+	// Test: A request body cut short is a 400 from the ErrorHandler
+	req, err := request.HeadFromReader(strings.NewReader("POST /httpbin/post HTTP/1.1\r\nContent-Length: 5\r\n\r\nhi"))
+	require.NoError(t, err)
+	rec, w := response.NewRecorder()
+	proxyHandler(w, req)
+	assert.Equal(t, response.StatusCodeBadRequest, rec.StatusCode)
+	assert.Equal(t, "Bad Request: body shorter than Content-Length\n", rec.Body.String())
+
+	// Test: An upstream that doesn't answer in time is a 504
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+	useUpstream(t, upstream.URL, 50*time.Millisecond)
+	rec = proxy("/httpbin/delay/10")
+	assert.Equal(t, response.StatusCodeGatewayTimeout, rec.StatusCode)
+	assert.Contains(t, rec.Body.String(), "Gateway Timeout")
+}
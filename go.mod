@@ -2,9 +2,15 @@ module HTTPFTCP
 
 go 1.25.1
 
+require (
+	github.com/klauspost/compress v1.20.1
+	github.com/stretchr/testify v1.11.1
+	golang.org/x/crypto v0.46.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.11.1 // indirect
+	golang.org/x/sys v0.39.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,166 @@
+// Package accesslog is middleware that records every request through a
+// log/slog Logger, either as JSON through slog's own handlers or as lines in
+// Common Log Format, Combined Log Format or a custom template through
+// NewHandler. RotatingFile gives it a log file that rotates by size or on
+// demand.
+package accesslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"HTTPFTCP/internal/auth"
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// Attribute keys of the records the middleware logs.
+const (
+	KeyMethod     = "method"
+	KeyTarget     = "target"
+	KeyProto      = "proto"
+	KeyStatus     = "status"
+	KeyBytes      = "bytes"
+	KeyDuration   = "duration"
+	KeyRemoteAddr = "remote_addr"
+	KeyUserAgent  = "user_agent"
+	KeyReferer    = "referer"
+	KeyRequestID  = "request_id"
+	KeyUser       = "user"
+)
+
+// maxRequestIDLength caps request IDs taken from clients.
+const maxRequestIDLength = 128
+
+type Options struct {
+	// Logger receives a record per request. Defaults to slog.Default().
+	Logger *slog.Logger
+	// RequestIDHeader is the field a request ID is taken from, if the
+	// client sent an acceptable one, and echoed in. Defaults to
+	// X-Request-Id.
+	RequestIDHeader string
+}
+
+type contextKey struct{}
+
+// RequestID returns the ID the middleware gave req, or "".
+func RequestID(req *request.Request) string {
+	id, _ := req.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware logs each request once its handler returns, or panics. A
+// request that got no response is logged with status 500, which is what
+// the server sends when it recovers a panic. It should be the outermost
+// middleware so that it sees requests other middleware answers and the
+// bytes that actually went out.
+func Middleware(opts Options) server.Middleware {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.RequestIDHeader == "" {
+		opts.RequestIDHeader = "X-Request-Id"
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			id, ok := req.Headers.Get(opts.RequestIDHeader)
+			if !ok || !validRequestID(id) {
+				id = newRequestID()
+			}
+			req.SetValue(contextKey{}, id)
+
+			cs := &countingSink{Writer: w, idHeader: opts.RequestIDHeader, id: id}
+			defer func() {
+				status := cs.status
+				if status == 0 {
+					status = response.StatusCodeInternalServerError
+				}
+				attrs := []slog.Attr{
+					slog.String(KeyMethod, req.RequestLine.Method),
+					slog.String(KeyTarget, req.RequestLine.RequestTarget),
+					slog.String(KeyProto, "HTTP/"+req.RequestLine.HttpVersion),
+					slog.Int(KeyStatus, int(status)),
+					slog.Int64(KeyBytes, cs.bytes),
+					slog.Duration(KeyDuration, time.Since(start)),
+					slog.String(KeyRemoteAddr, req.RemoteAddr),
+					slog.String(KeyUserAgent, field(req.Headers, "User-Agent")),
+					slog.String(KeyReferer, field(req.Headers, "Referer")),
+					slog.String(KeyRequestID, id),
+				}
+				if p := auth.FromRequest(req); p != nil {
+					attrs = append(attrs, slog.String(KeyUser, p.Name))
+				}
+				// the request's context may be cancelled by now, and a
+				// handler that drops records for that would lose this one
+				opts.Logger.LogAttrs(context.WithoutCancel(req.Context()), slog.LevelInfo, "request", attrs...)
+			}()
+
+			next(response.NewSinkWriter(cs), req)
+		}
+	}
+}
+
+func field(h headers.Headers, key string) string {
+	v, _ := h.Get(key)
+	return v
+}
+
+// validRequestID accepts IDs that are safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// countingSink notes the status and counts the body bytes written, and
+// adds the request ID to the response.
+type countingSink struct {
+	*response.Writer
+	idHeader string
+	id       string
+	status   response.StatusCode
+	bytes    int64
+}
+
+func (c *countingSink) WriteStatusLineWithReason(statusCode response.StatusCode, reason string) error {
+	c.status = statusCode
+	return c.Writer.WriteStatusLineWithReason(statusCode, reason)
+}
+
+func (c *countingSink) WriteHeaders(h headers.Headers) error {
+	if _, ok := h.Get(c.idHeader); !ok {
+		h.Override(c.idHeader, c.id)
+	}
+	return c.Writer.WriteHeaders(h)
+}
+
+func (c *countingSink) WriteBody(p []byte) (int, error) {
+	n, err := c.Writer.WriteBody(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func (c *countingSink) WriteChunkedBody(p []byte) (int, error) {
+	n, err := c.Writer.WriteChunkedBody(p)
+	c.bytes += int64(n)
+	return n, err
+}
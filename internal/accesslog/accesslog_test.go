@@ -0,0 +1,140 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(target string, fields ...string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+		RemoteAddr:  "192.0.2.7:51234",
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	return req
+}
+
+func hello(w *response.Writer, req *request.Request) {
+	body := []byte("hello, " + RequestID(req))
+	w.WriteStatusLine(response.StatusCodeCreated)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func chunked(w *response.Writer, _ *request.Request) {
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	w.WriteHeaders(h)
+	w.WriteChunkedBody([]byte("abc"))
+	w.WriteChunkedBody([]byte("de"))
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(headers.NewHeaders())
+}
+
+func serve(t *testing.T, mw server.Middleware, h server.Handler, req *request.Request) *response.Recorder {
+	t.Helper()
+	rec, w := response.NewRecorder()
+	mw(h)(w, req)
+	return rec
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	mw := Middleware(Options{Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+
+	// Test: Every field is recorded and the ID is echoed
+	rec := serve(t, mw, hello, newRequest("/a?b=c", "User-Agent", "curl/8", "X-Request-Id", "abc-123"))
+	assert.Equal(t, "abc-123", rec.Headers["x-request-id"])
+	assert.Equal(t, "hello, abc-123", rec.Body.String())
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "request", got["msg"])
+	assert.Equal(t, "GET", got[KeyMethod])
+	assert.Equal(t, "/a?b=c", got[KeyTarget])
+	assert.Equal(t, "HTTP/1.1", got[KeyProto])
+	assert.Equal(t, float64(201), got[KeyStatus])
+	assert.Equal(t, float64(len("hello, abc-123")), got[KeyBytes])
+	assert.Contains(t, got, KeyDuration)
+	assert.Equal(t, "192.0.2.7:51234", got[KeyRemoteAddr])
+	assert.Equal(t, "curl/8", got[KeyUserAgent])
+	assert.Equal(t, "abc-123", got[KeyRequestID])
+
+	// Test: Unsafe request IDs are replaced with fresh ones
+	buf.Reset()
+	rec = serve(t, mw, hello, newRequest("/", "X-Request-Id", "bad id\"!"))
+	assert.Regexp(t, `^[0-9a-f]{16}$`, rec.Headers["x-request-id"])
+
+	// Test: Chunked bodies count the data, not the framing
+	buf.Reset()
+	serve(t, mw, chunked, newRequest("/"))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, float64(5), got[KeyBytes])
+
+	// Test: A handler that panics is still logged, as the server's 500
+	buf.Reset()
+	assert.Panics(t, func() {
+		serve(t, mw, func(*response.Writer, *request.Request) { panic("boom") }, newRequest("/panic"))
+	})
+	got = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "/panic", got[KeyTarget])
+	assert.Equal(t, float64(500), got[KeyStatus])
+	assert.Equal(t, float64(0), got[KeyBytes])
+}
+
+func TestFormats(t *testing.T) {
+	var buf bytes.Buffer
+	logTo := func(f *Format) server.Middleware {
+		buf.Reset()
+		return Middleware(Options{Logger: slog.New(NewHandler(&buf, f))})
+	}
+	req := func() *request.Request {
+		return newRequest(`/say?q="hi"`, "User-Agent", "Mozilla/5.0", "Referer", "http://example.com/", "X-Request-Id", "r1")
+	}
+
+	// Test: Common Log Format
+	serve(t, logTo(CommonLog), hello, req())
+	assert.Regexp(t, regexp.MustCompile(`^192\.0\.2\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [-+]\d{4}\] "GET /say\?q=\\"hi\\" HTTP/1\.1" 201 9\n$`), buf.String())
+
+	// Test: Combined Log Format adds the referer and user agent
+	serve(t, logTo(CombinedLog), hello, req())
+	assert.Regexp(t, `" 201 9 "http://example.com/" "Mozilla/5.0"\n$`, buf.String())
+
+	// Test: Empty fields are dashes
+	serve(t, logTo(CombinedLog), func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeNoContent)
+		w.WriteHeaders(headers.NewHeaders())
+	}, newRequest("/"))
+	assert.Regexp(t, `" 204 - "-" "-"\n$`, buf.String())
+
+	// Test: Custom templates see every field
+	f, err := ParseFormat(`{{.RequestID}} {{.Method}} {{.Status}} {{.Bytes}} {{if gt .Duration 0}}timed{{end}} {{escape .UserAgent}}`)
+	require.NoError(t, err)
+	serve(t, logTo(f), hello, newRequest("/", "X-Request-Id", "r2", "User-Agent", "a\tb"))
+	assert.Equal(t, "r2 GET 201 9 timed a\\x09b\n", buf.String())
+
+	_, err = ParseFormat("{{.Nope")
+	assert.Error(t, err)
+
+	// Test: Records that aren't requests still come out
+	buf.Reset()
+	h := NewHandler(&buf, CommonLog).WithAttrs([]slog.Attr{slog.String(KeyMethod, "PUT")})
+	slog.New(h).Info("hello", KeyStatus, "not a number", KeyDuration, time.Second)
+	assert.Contains(t, buf.String(), `"PUT  " 0 -`)
+}
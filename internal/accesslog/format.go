@@ -0,0 +1,200 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Entry is one logged request, as seen by a Format's template.
+type Entry struct {
+	Time       time.Time
+	Method     string
+	Target     string
+	Proto      string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+	RemoteAddr string
+	UserAgent  string
+	Referer    string
+	RequestID  string
+	User       string
+}
+
+// Host is the client's IP address.
+func (e Entry) Host() string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		return e.RemoteAddr
+	}
+	return host
+}
+
+// Format renders an Entry as one log line.
+type Format struct {
+	tmpl *template.Template
+}
+
+// ParseFormat parses a text/template over Entry, such as
+// `{{.Method}} {{.Target}} {{.Status}} {{.Duration}}`. Besides the usual
+// functions it has:
+//
+//	dash    "-" in place of an empty string or zero
+//	clftime the time as Common Log Format writes it
+//	escape  backslash-escapes quotes, backslashes and control characters
+func ParseFormat(text string) (*Format, error) {
+	tmpl, err := template.New("accesslog").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Format{tmpl: tmpl}, nil
+}
+
+// MustParseFormat is ParseFormat for formats known to be good.
+func MustParseFormat(text string) *Format {
+	f, err := ParseFormat(text)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+var (
+	// CommonLog is the Common Log Format of NCSA httpd and Apache.
+	CommonLog = MustParseFormat(commonLog)
+	// CombinedLog is CommonLog plus the referer and user agent.
+	CombinedLog = MustParseFormat(commonLog + ` "{{escape .Referer | dash}}" "{{escape .UserAgent | dash}}"`)
+)
+
+const commonLog = `{{.Host | dash}} - {{escape .User | dash}} [{{clftime .Time}}] "{{.Method}} {{escape .Target}} {{.Proto}}" {{.Status}} {{.Bytes | dash}}`
+
+var funcs = template.FuncMap{
+	"dash": func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if v == "" {
+				return "-"
+			}
+		case int64:
+			if v == 0 {
+				return "-"
+			}
+		}
+		return v
+	},
+	"clftime": func(t time.Time) string {
+		return t.Format("02/Jan/2006:15:04:05 -0700")
+	},
+	"escape": escape,
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			b.WriteString(`\x`)
+			b.WriteString(strconv.FormatInt(int64(r)|0x100, 16)[1:])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// handler is a slog.Handler writing the middleware's records as lines.
+type handler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	format *Format
+	attrs  []slog.Attr
+}
+
+// NewHandler returns a slog.Handler that writes each record the middleware
+// logs to w as a line in format. It is meant for a Logger of its own;
+// other records come out with most fields empty.
+func NewHandler(w io.Writer, format *Format) slog.Handler {
+	return &handler{mu: &sync.Mutex{}, w: w, format: format}
+}
+
+func (h *handler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	e := Entry{Time: r.Time}
+	set := func(a slog.Attr) bool {
+		e.set(a)
+		return true
+	}
+	for _, a := range h.attrs {
+		set(a)
+	}
+	r.Attrs(set)
+
+	var buf bytes.Buffer
+	if err := h.format.tmpl.Execute(&buf, e); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &c
+}
+
+// WithGroup returns h unchanged; the record's fields are all top level.
+func (h *handler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (e *Entry) set(a slog.Attr) {
+	v := a.Value.Resolve()
+	switch a.Key {
+	case KeyMethod:
+		e.Method = v.String()
+	case KeyTarget:
+		e.Target = v.String()
+	case KeyProto:
+		e.Proto = v.String()
+	case KeyStatus:
+		if v.Kind() == slog.KindInt64 {
+			e.Status = int(v.Int64())
+		}
+	case KeyBytes:
+		if v.Kind() == slog.KindInt64 {
+			e.Bytes = v.Int64()
+		}
+	case KeyDuration:
+		if v.Kind() == slog.KindDuration {
+			e.Duration = v.Duration()
+		}
+	case KeyRemoteAddr:
+		e.RemoteAddr = v.String()
+	case KeyUserAgent:
+		e.UserAgent = v.String()
+	case KeyReferer:
+		e.Referer = v.String()
+	case KeyRequestID:
+		e.RequestID = v.String()
+	case KeyUser:
+		e.User = v.String()
+	}
+}
@@ -0,0 +1,155 @@
+package accesslog
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files so that they sort by age.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile is a log file that is moved aside and started afresh once it
+// would grow past a size, or whenever Rotate is called.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	now        func() time.Time
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending. A write that would take it
+// past maxSize bytes rotates it first; zero means no limit. Rotated files
+// are named path.TIMESTAMP and only the newest maxBackups are kept, or all
+// of them when maxBackups is zero.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, now: time.Now}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one. If something
+// else, like logrotate, has already moved it, Rotate just reopens path.
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+	return rf.rotate()
+}
+
+// rotate keeps the old file open until the new one is, so that if either
+// step fails, writes carry on where they were and the next one tries again.
+func (rf *RotatingFile) rotate() error {
+	old := rf.f
+	backup := rf.path + "." + rf.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return errors.Join(old.Close(), rf.prune())
+}
+
+// prune removes all but the newest maxBackups rotated files.
+func (rf *RotatingFile) prune() error {
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	backups = slices.DeleteFunc(backups, func(name string) bool {
+		_, err := time.Parse(backupTimeFormat, name[len(rf.path)+1:])
+		return err != nil
+	})
+	slices.Sort(backups)
+	for len(backups) > rf.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// RotateOnSignal rotates the file each time one of sigs arrives, usually
+// SIGHUP, until stop is called.
+func (rf *RotatingFile) RotateOnSignal(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := rf.Rotate(); err != nil {
+					log.Printf("accesslog: error rotating %s: %v", rf.path, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
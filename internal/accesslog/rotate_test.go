@@ -0,0 +1,88 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+	tick := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rf, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer rf.Close()
+	rf.now = func() time.Time {
+		tick = tick.Add(time.Second)
+		return tick
+	}
+
+	// Test: Appends to an existing file until the next write would overflow
+	_, err = rf.Write([]byte("line1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "old\nline1\n", readFile(t, path))
+	_, err = rf.Write([]byte("line2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "line2\n", readFile(t, path))
+	assert.Equal(t, "old\nline1\n", readFile(t, path+".20250101T000001.000000000"))
+
+	// Test: A single write bigger than the limit still goes in a fresh file
+	_, err = rf.Write([]byte("a very long line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a very long line\n", readFile(t, path))
+
+	// Test: Only the newest backups are kept
+	require.NoError(t, rf.Rotate())
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{path + ".20250101T000002.000000000", path + ".20250101T000003.000000000"}, backups)
+
+	// Test: A file moved away by someone else is just reopened
+	require.NoError(t, os.Rename(path, filepath.Join(dir, "moved.log")))
+	require.NoError(t, rf.Rotate())
+	_, err = rf.Write([]byte("new\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "new\n", readFile(t, path))
+
+	// Test: A failed rotation keeps writing to the current file
+	stuck := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time { return stuck }
+	blocker := path + "." + stuck.Format(backupTimeFormat)
+	require.NoError(t, os.MkdirAll(filepath.Join(blocker, "x"), 0o755))
+	assert.Error(t, rf.Rotate())
+	_, err = rf.Write([]byte("still\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "new\nstill\n", readFile(t, path))
+	require.NoError(t, os.RemoveAll(blocker))
+	require.NoError(t, rf.Rotate())
+	assert.Equal(t, "new\nstill\n", readFile(t, blocker))
+
+	// Test: SIGHUP rotates
+	stop := rf.RotateOnSignal(syscall.SIGHUP)
+	defer stop()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Size() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Test: Closed files refuse writes
+	require.NoError(t, rf.Close())
+	_, err = rf.Write([]byte("x"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
@@ -0,0 +1,122 @@
+// Package auth is middleware that authenticates requests with HTTP Basic
+// credentials, Bearer JWTs or HTTP Message Signatures (RFC 9421) and
+// attaches the authenticated Principal to the request.
+package auth
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request doesn't
+// carry credentials of its kind, so the next one should be tried.
+var ErrNoCredentials = errors.New("auth: no credentials")
+
+// ErrInvalid is returned, possibly wrapped, when a request's credentials
+// are present but wrong.
+var ErrInvalid = errors.New("auth: invalid credentials")
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	// Name is the user name, the token's subject or the signing key's ID.
+	Name string
+	// Scheme is the Authenticator that accepted the request: "basic",
+	// "bearer" or "signature".
+	Scheme string
+	// Claims holds a JWT's claims. It is nil for other schemes.
+	Claims map[string]any
+}
+
+// Authenticator checks one kind of credentials.
+type Authenticator interface {
+	// Authenticate returns the request's principal, ErrNoCredentials if
+	// the request has none of this kind, or an error wrapping ErrInvalid.
+	Authenticate(req *request.Request) (*Principal, error)
+	// Challenge is the WWW-Authenticate value sent when authentication
+	// fails.
+	Challenge() string
+}
+
+type Options struct {
+	// Authenticators are tried in order until one finds credentials.
+	Authenticators []Authenticator
+	// Optional lets requests without credentials through anonymously.
+	// Requests with bad credentials are still refused.
+	Optional bool
+}
+
+type contextKey struct{}
+
+// FromRequest returns the principal the middleware attached to req, or nil
+// if the request is anonymous.
+func FromRequest(req *request.Request) *Principal {
+	p, _ := req.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Middleware authenticates each request before calling the handler and
+// answers 401 Unauthorized, with a challenge from every Authenticator, when
+// that fails.
+func Middleware(opts Options) server.Middleware {
+	if len(opts.Authenticators) == 0 {
+		panic("auth: no authenticators")
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			p, err := authenticate(opts.Authenticators, req)
+			switch {
+			case err == nil:
+				req.SetValue(contextKey{}, p)
+			case errors.Is(err, ErrNoCredentials) && opts.Optional:
+			default:
+				if !errors.Is(err, ErrNoCredentials) {
+					log.Printf("auth: %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+				}
+				writeUnauthorized(w, opts.Authenticators)
+				return
+			}
+			next(w, req)
+		}
+	}
+}
+
+func authenticate(authenticators []Authenticator, req *request.Request) (*Principal, error) {
+	for _, a := range authenticators {
+		p, err := a.Authenticate(req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func writeUnauthorized(w *response.Writer, authenticators []Authenticator) {
+	body := []byte("Unauthorized\n")
+	w.WriteStatusLine(response.StatusCodeUnauthorized)
+	for _, a := range authenticators {
+		w.AddHeaderLine("WWW-Authenticate", a.Challenge())
+	}
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// credentials splits an Authorization value into its scheme, which is
+// compared case-insensitively, and the rest.
+func credentials(h headers.Headers, scheme string) (string, bool) {
+	v, ok := h.Get("Authorization")
+	if !ok {
+		return "", false
+	}
+	s, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+	if !strings.EqualFold(s, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newRequest(method, target string, fields ...string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	return req
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func testCredentials(t *testing.T) Credentials {
+	bc, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	require.NoError(t, err)
+	argon, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	creds, err := ParseCredentials(strings.NewReader(
+		"# users\n\nalice:" + string(bc) + "\nbob:" + argon + "\n"))
+	require.NoError(t, err)
+	return creds
+}
+
+func TestParseCredentials(t *testing.T) {
+	// Test: Unknown hash formats are refused with the line number
+	_, err := ParseCredentials(strings.NewReader("alice:$2y$04$abc\nbob:{SHA}abc\n"))
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ParseCredentials(strings.NewReader("bob:{SHA}abc\n"))
+	assert.ErrorContains(t, err, "line 1: unsupported password hash")
+	_, err = ParseCredentials(strings.NewReader("nocolon\n"))
+	assert.ErrorContains(t, err, "want user:hash")
+
+	// Test: Argon2 PHC strings round-trip and check parameters
+	h, err := HashPassword("pw")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(h, "$argon2id$v=19$m=65536,t=3,p=4$"))
+	assert.True(t, VerifyPassword(h, "pw"))
+	assert.False(t, VerifyPassword(h, "pw2"))
+	assert.False(t, VerifyPassword("$argon2id$v=19$m=65536,t=0,p=4$AAAA$AAAA", "pw"))
+	assert.False(t, VerifyPassword("$argon2d$v=19$m=65536,t=3,p=4$AAAA$AAAA", "pw"))
+}
+
+func TestBasic(t *testing.T) {
+	b := NewBasic(`the "realm"`, testCredentials(t))
+
+	// Test: bcrypt and argon2id users both log in
+	p, err := b.Authenticate(newRequest("GET", "/", "Authorization", basicAuth("alice", "hunter2")))
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "alice", Scheme: "basic"}, p)
+	p, err = b.Authenticate(newRequest("GET", "/", "Authorization", basicAuth("bob", "correct horse")))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", p.Name)
+
+	// Test: Scheme is case-insensitive and the password may hold colons
+	creds := Credentials{}
+	creds["carol"], _ = HashPassword("a:b")
+	p, err = NewBasic("r", creds).Authenticate(newRequest("GET", "/", "Authorization",
+		"basic "+base64.StdEncoding.EncodeToString([]byte("carol:a:b"))))
+	require.NoError(t, err)
+	assert.Equal(t, "carol", p.Name)
+
+	// Test: Wrong password, unknown user and garbage are invalid
+	_, err = b.Authenticate(newRequest("GET", "/", "Authorization", basicAuth("alice", "hunter3")))
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = b.Authenticate(newRequest("GET", "/", "Authorization", basicAuth("mallory", "")))
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = b.Authenticate(newRequest("GET", "/", "Authorization", "Basic !!!"))
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// Test: Unknown users are checked against the cheapest configured hash
+	assert.Equal(t, b.creds["alice"], b.dummy)
+	slow := Credentials{"bob": b.creds["bob"], "dave": "$argon2id$v=19$m=1024,t=1,p=1$AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAA"}
+	assert.Equal(t, slow["dave"], NewBasic("r", slow).dummy)
+	_, err = NewBasic("r", Credentials{}).Authenticate(newRequest("GET", "/", "Authorization", basicAuth("mallory", "")))
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// Test: Other schemes are not this authenticator's business
+	_, err = b.Authenticate(newRequest("GET", "/", "Authorization", "Bearer abc"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+	_, err = b.Authenticate(newRequest("GET", "/"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	assert.Equal(t, `Basic realm="the \"realm\"", charset="UTF-8"`, b.Challenge())
+}
+
+func TestMiddleware(t *testing.T) {
+	b := NewBasic("test", testCredentials(t))
+	var seen *Principal
+	handler := func(w *response.Writer, req *request.Request) {
+		seen = FromRequest(req)
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+	jwt := &JWT{Realm: "api", Keys: &KeySet{}}
+	h := Middleware(Options{Authenticators: []Authenticator{b, jwt}})(handler)
+
+	// Test: Authenticated principal reaches the handler
+	rec, w := response.NewRecorder()
+	h(w, newRequest("GET", "/", "Authorization", basicAuth("alice", "hunter2")))
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, "alice", seen.Name)
+
+	// Test: Missing credentials get 401 with a challenge per scheme
+	seen = nil
+	rec, w = response.NewRecorder()
+	h(w, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusCodeUnauthorized, rec.StatusCode)
+	assert.Nil(t, seen)
+	require.Len(t, rec.HeaderLines, 2)
+	assert.Equal(t, `Basic realm="test", charset="UTF-8"`, rec.HeaderLines[0].Value)
+	assert.Equal(t, `Bearer realm="api"`, rec.HeaderLines[1].Value)
+
+	// Test: Optional lets anonymous requests through but not bad ones
+	h = Middleware(Options{Authenticators: []Authenticator{b}, Optional: true})(handler)
+	rec, w = response.NewRecorder()
+	h(w, newRequest("GET", "/"))
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Nil(t, seen)
+	rec, w = response.NewRecorder()
+	h(w, newRequest("GET", "/", "Authorization", basicAuth("alice", "nope")))
+	assert.Equal(t, response.StatusCodeUnauthorized, rec.StatusCode)
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"HTTPFTCP/internal/request"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Credentials maps user names to password hashes, either bcrypt ("$2a$",
+// "$2b$" or "$2y$") or Argon2 in the PHC string format
+// ("$argon2id$v=19$m=65536,t=3,p=4$salt$hash").
+type Credentials map[string]string
+
+// LoadCredentials reads a credentials file holding one "user:hash" per
+// line, as written by htpasswd -B. Blank lines and lines starting with "#"
+// are skipped.
+func LoadCredentials(path string) (Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCredentials(f)
+}
+
+func ParseCredentials(r io.Reader) (Credentials, error) {
+	creds := Credentials{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("auth: credentials line %d: want user:hash", n)
+		}
+		if _, err := parseHash(hash); err != nil {
+			return nil, fmt.Errorf("auth: credentials line %d: %w", n, err)
+		}
+		creds[user] = hash
+	}
+	return creds, scanner.Err()
+}
+
+// Basic authenticates "Authorization: Basic" credentials (RFC 7617).
+//
+// Every attempt costs a password hash check, which is deliberately slow:
+// with the parameters HashPassword uses, 64 MiB and three Argon2id passes.
+// Attempts naming unknown users are checked against the cheapest hash in
+// the credentials, so that they take as long as a real check but no
+// longer. Anyone can make the server pay that cost, so rate limit Basic
+// authentication in front of it.
+type Basic struct {
+	Realm string
+	creds Credentials
+	dummy string // cheapest hash in creds, for unknown users
+}
+
+func NewBasic(realm string, creds Credentials) *Basic {
+	b := &Basic{Realm: realm, creds: creds}
+	var cheapest uint64
+	for _, hash := range creds {
+		h, err := parseHash(hash)
+		if err != nil {
+			continue
+		}
+		if c := h.cost(); b.dummy == "" || c < cheapest {
+			b.dummy, cheapest = hash, c
+		}
+	}
+	return b
+}
+
+func (b *Basic) Authenticate(req *request.Request) (*Principal, error) {
+	v, ok := credentials(req.Headers, "Basic")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	decoded, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed basic credentials", ErrInvalid)
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed basic credentials", ErrInvalid)
+	}
+	hash, known := b.creds[user]
+	if !known {
+		// spend as long as a real check so response times don't reveal
+		// which users exist
+		hash = b.dummy
+	}
+	if !VerifyPassword(hash, password) || !known {
+		return nil, fmt.Errorf("%w: wrong password for %q", ErrInvalid, user)
+	}
+	return &Principal{Name: user, Scheme: "basic"}, nil
+}
+
+func (b *Basic) Challenge() string {
+	return fmt.Sprintf(`Basic realm=%s, charset="UTF-8"`, quote(b.Realm))
+}
+
+// VerifyPassword reports whether password matches hash, which is in one of
+// the formats Credentials accepts.
+func VerifyPassword(hash, password string) bool {
+	h, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+	return h.verify(password)
+}
+
+// HashPassword hashes password with Argon2id, using the parameters RFC 9106
+// recommends for memory-constrained servers.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	h := argon2Hash{variant: "argon2id", memory: 64 << 10, time: 3, threads: 4, salt: salt}
+	h.key = h.derive(password, 32)
+	return h.String(), nil
+}
+
+type passwordHash interface {
+	verify(password string) bool
+	// cost is roughly how much work verify does, in KiB of memory filled
+	// by Argon2, so that hashes of either kind can be compared.
+	cost() uint64
+}
+
+func parseHash(hash string) (passwordHash, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, err
+		}
+		return bcryptHash(hash), nil
+	case strings.HasPrefix(hash, "$argon2"):
+		return parseArgon2(hash)
+	}
+	return nil, fmt.Errorf("unsupported password hash")
+}
+
+type bcryptHash string
+
+func (h bcryptHash) verify(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil
+}
+
+// bcryptRoundCost is the Argon2 work, in KiB, that takes about as long as
+// one bcrypt round: bcrypt at cost 10 is about as slow as Argon2id with
+// m=65536 and t=3.
+const bcryptRoundCost = 192
+
+func (h bcryptHash) cost() uint64 {
+	c, _ := bcrypt.Cost([]byte(h))
+	return bcryptRoundCost << c
+}
+
+type argon2Hash struct {
+	variant string // argon2id or argon2i
+	memory  uint32 // KiB
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2(hash string) (*argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, fmt.Errorf("malformed argon2 hash")
+	}
+	h := &argon2Hash{variant: parts[1]}
+	if h.variant != "argon2id" && h.variant != "argon2i" {
+		return nil, fmt.Errorf("unsupported argon2 variant %q", h.variant)
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("malformed argon2 parameters %q", parts[3])
+	}
+	if h.time == 0 || h.threads == 0 {
+		return nil, fmt.Errorf("malformed argon2 parameters %q", parts[3])
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2 salt")
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("malformed argon2 hash")
+	}
+	return h, nil
+}
+
+func (h *argon2Hash) derive(password string, keyLen uint32) []byte {
+	if h.variant == "argon2i" {
+		return argon2.Key([]byte(password), h.salt, h.time, h.memory, h.threads, keyLen)
+	}
+	return argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, keyLen)
+}
+
+func (h *argon2Hash) verify(password string) bool {
+	key := h.derive(password, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func (h *argon2Hash) cost() uint64 {
+	return uint64(h.memory) * uint64(h.time)
+}
+
+func (h *argon2Hash) String() string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", h.variant, argon2.Version,
+		h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(h.salt),
+		base64.RawStdEncoding.EncodeToString(h.key))
+}
+
+// quote writes s as an HTTP quoted-string.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minRSABits is the smallest RSA modulus a key set may hold.
+const minRSABits = 2048
+
+// Key is a verification key from a JSON Web Key Set (RFC 7517).
+type Key struct {
+	ID string
+	// Type is the JWK kty: "oct", "RSA" or "OKP".
+	Type string
+	// Algorithm is the JWK alg, if the key is restricted to one.
+	Algorithm string
+	key       any // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// KeySet holds the keys tokens and signatures are checked against.
+type KeySet struct {
+	keys []*Key
+}
+
+// LoadJWKS reads a JWK Set file.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// ParseJWKS parses a JWK Set. Keys of unknown types, and keys meant for
+// encryption rather than signatures, are skipped as RFC 7517 asks.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: parsing JWKS: %w", err)
+	}
+	ks := &KeySet{}
+	for i, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("auth: JWKS key %d (%q): %w", i, j.Kid, err)
+		}
+		if k != nil {
+			ks.keys = append(ks.keys, k)
+		}
+	}
+	return ks, nil
+}
+
+func (j jwk) key() (*Key, error) {
+	k := &Key{ID: j.Kid, Type: j.Kty, Algorithm: j.Alg}
+	switch j.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("bad k")
+		}
+		k.key = secret
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil || len(n) == 0 {
+			return nil, fmt.Errorf("bad n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("bad e")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key shorter than %d bits", minRSABits)
+		}
+		k.key = pub
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("bad x")
+		}
+		k.key = ed25519.PublicKey(x)
+	default:
+		return nil, nil
+	}
+	return k, nil
+}
+
+// Keys returns the keys in the set.
+func (ks *KeySet) Keys() []*Key {
+	return ks.keys
+}
+
+// candidates returns the keys that may have made a signature with alg:
+// the one named kid, or when kid is empty every key of the right type.
+func (ks *KeySet) candidates(kid string, alg *algorithm) []*Key {
+	var keys []*Key
+	for _, k := range ks.keys {
+		if k.Type != alg.kty || k.Algorithm != "" && k.Algorithm != alg.jose {
+			continue
+		}
+		if kid == "" || k.ID == kid {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// algorithm is a signature algorithm under its JOSE (RFC 7518) and HTTP
+// Message Signatures (RFC 9421) names.
+type algorithm struct {
+	jose    string
+	httpsig string
+	kty     string
+	verify  func(key any, data, sig []byte) bool
+}
+
+var algorithms = []*algorithm{
+	{jose: "HS256", httpsig: "hmac-sha256", kty: "oct", verify: verifyHMACSHA256},
+	{jose: "RS256", httpsig: "rsa-v1_5-sha256", kty: "RSA", verify: verifyRSAPKCS1SHA256},
+	{jose: "PS512", httpsig: "rsa-pss-sha512", kty: "RSA", verify: verifyRSAPSSSHA512},
+	{jose: "EdDSA", httpsig: "ed25519", kty: "OKP", verify: verifyEd25519},
+}
+
+func joseAlgorithm(name string) (*algorithm, bool) {
+	for _, a := range algorithms {
+		if a.jose == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+func httpsigAlgorithm(name string) (*algorithm, bool) {
+	for _, a := range algorithms {
+		if a.httpsig == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+func verifyHMACSHA256(key any, data, sig []byte) bool {
+	mac := hmac.New(sha256.New, key.([]byte))
+	mac.Write(data)
+	return hmac.Equal(mac.Sum(nil), sig)
+}
+
+func verifyRSAPKCS1SHA256(key any, data, sig []byte) bool {
+	sum := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, sum[:], sig) == nil
+}
+
+func verifyRSAPSSSHA512(key any, data, sig []byte) bool {
+	sum := sha512.Sum512(data)
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	return rsa.VerifyPSS(key.(*rsa.PublicKey), crypto.SHA512, sum[:], sig, opts) == nil
+}
+
+func verifyEd25519(key any, data, sig []byte) bool {
+	return ed25519.Verify(key.(ed25519.PublicKey), data, sig)
+}
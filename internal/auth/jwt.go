@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"HTTPFTCP/internal/request"
+)
+
+// JWT authenticates "Authorization: Bearer" tokens that are JSON Web Tokens
+// (RFC 7519) signed with HS256, RS256, PS512 or EdDSA by a key in Keys.
+type JWT struct {
+	Realm string
+	Keys  *KeySet
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Leeway allows for clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+type jwtHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+func (j *JWT) Authenticate(req *request.Request) (*Principal, error) {
+	token, ok := credentials(req.Headers, "Bearer")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	claims, err := j.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalid)
+	}
+	return &Principal{Name: sub, Scheme: "bearer", Claims: claims}, nil
+}
+
+func (j *JWT) Challenge() string {
+	return "Bearer realm=" + quote(j.Realm)
+}
+
+// Verify checks token's signature and registered claims and returns its
+// claims. Numbers in them are json.Number.
+func (j *JWT) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: token is not a signed JWT", ErrInvalid)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: token header: %v", ErrInvalid, err)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("%w: unsupported critical header %q", ErrInvalid, header.Crit)
+	}
+	alg, ok := joseAlgorithm(header.Alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalid, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: token signature: %v", ErrInvalid, err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range j.Keys.candidates(header.Kid, alg) {
+		if alg.verify(k.key, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: bad token signature", ErrInvalid)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: token claims: %v", ErrInvalid, err)
+	}
+	if err := j.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *JWT) checkClaims(claims map[string]any) error {
+	now := time.Now()
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(j.Leeway)) {
+		return fmt.Errorf("%w: token expired at %v", ErrInvalid, exp)
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(j.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: token not valid before %v", ErrInvalid, nbf)
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return fmt.Errorf("%w: wrong issuer %v", ErrInvalid, claims["iss"])
+	}
+	if j.Audience != "" && !hasAudience(claims["aud"], j.Audience) {
+		return fmt.Errorf("%w: wrong audience %v", ErrInvalid, claims["aud"])
+	}
+	return nil
+}
+
+// numericDate reads a claim holding seconds since the epoch, which may
+// have a fractional part.
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrInvalid, name)
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsInf(f, 0) {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrInvalid, name)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// hasAudience reports whether aud, a string or an array of them, holds want.
+func hasAudience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var b64 = base64.RawURLEncoding
+
+type testKeys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ed     ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testKeys{secret: []byte("a very secret shared secret"), rsa: rsaKey, ed: edKey}
+}
+
+func (k *testKeys) jwks() string {
+	return fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "AA", "y": "AA"}
+	]}`,
+		b64.EncodeToString(k.secret),
+		b64.EncodeToString(k.rsa.N.Bytes()),
+		b64.EncodeToString(big.NewInt(int64(k.rsa.E)).Bytes()),
+		b64.EncodeToString(k.ed.Public().(ed25519.PublicKey)))
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	var sig []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case "RS256":
+		sum := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, sum[:])
+		require.NoError(t, err)
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(keys.jwks()), 0o600))
+
+	// Test: Encryption and unknown key types are skipped
+	ks, err := LoadJWKS(path)
+	require.NoError(t, err)
+	var ids []string
+	for _, k := range ks.Keys() {
+		ids = append(ids, k.ID)
+	}
+	assert.Equal(t, []string{"hmac", "rsa", "ed"}, ids)
+
+	// Test: Short RSA keys are refused
+	_, err = ParseJWKS([]byte(`{"keys": [{"kty": "RSA", "kid": "x", "n": "AQAB", "e": "AQAB"}]}`))
+	assert.ErrorContains(t, err, "shorter than 2048 bits")
+}
+
+func TestJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	ks, err := ParseJWKS([]byte(keys.jwks()))
+	require.NoError(t, err)
+	j := &JWT{Realm: "api", Keys: ks, Issuer: "https://issuer.example", Audience: "svc"}
+	now := time.Now().Unix()
+	claims := map[string]any{"sub": "alice", "iss": "https://issuer.example", "aud": []string{"other", "svc"}, "exp": now + 60, "scope": "read"}
+
+	// Test: Each algorithm verifies against its key
+	for _, c := range []struct{ alg, kid string }{{"HS256", "hmac"}, {"RS256", "rsa"}, {"EdDSA", "ed"}, {"EdDSA", ""}} {
+		token := keys.sign(t, c.alg, c.kid, claims)
+		p, err := j.Authenticate(newRequest("GET", "/", "Authorization", "Bearer "+token))
+		require.NoError(t, err, c.alg)
+		assert.Equal(t, "alice", p.Name)
+		assert.Equal(t, "bearer", p.Scheme)
+		assert.Equal(t, "read", p.Claims["scope"])
+	}
+
+	// Test: Algorithm confusion and unsigned tokens are refused
+	hs := keys.sign(t, "HS256", "rsa", claims)
+	_, err = j.Verify(hs)
+	assert.ErrorContains(t, err, "bad token signature")
+	none := b64.EncodeToString([]byte(`{"alg":"none"}`)) + "." + b64.EncodeToString([]byte(`{"sub":"alice"}`)) + "."
+	_, err = j.Verify(none)
+	assert.ErrorContains(t, err, `unsupported alg "none"`)
+
+	// Test: Tampered payload fails
+	token := keys.sign(t, "EdDSA", "ed", claims)
+	forged := keys.sign(t, "EdDSA", "ed", map[string]any{"sub": "mallory", "iss": "https://issuer.example", "aud": "svc"})
+	_, err = j.Verify(token[:len(token)-86] + forged[len(forged)-86:])
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// Test: Registered claims are checked
+	for name, c := range map[string]map[string]any{
+		"expired":        {"sub": "a", "iss": "https://issuer.example", "aud": "svc", "exp": now - 10},
+		"not valid":      {"sub": "a", "iss": "https://issuer.example", "aud": "svc", "nbf": now + 60},
+		"wrong issuer":   {"sub": "a", "iss": "https://evil.example", "aud": "svc"},
+		"wrong audience": {"sub": "a", "iss": "https://issuer.example", "aud": "other"},
+		"not a number":   {"sub": "a", "iss": "https://issuer.example", "aud": "svc", "exp": "tomorrow"},
+	} {
+		_, err := j.Verify(keys.sign(t, "HS256", "hmac", c))
+		assert.ErrorContains(t, err, name)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+
+	// Test: Leeway forgives a little clock skew
+	j.Leeway = time.Minute
+	_, err = j.Verify(keys.sign(t, "HS256", "hmac", map[string]any{"sub": "a", "iss": "https://issuer.example", "aud": "svc", "exp": now - 10}))
+	assert.NoError(t, err)
+
+	// Test: A token without a subject has no principal
+	_, err = j.Authenticate(newRequest("GET", "/", "Authorization", "Bearer "+keys.sign(t, "HS256", "hmac", map[string]any{"iss": "https://issuer.example", "aud": "svc"})))
+	assert.ErrorContains(t, err, "no subject")
+
+	// Test: Crit headers we don't understand are refused
+	crit := b64.EncodeToString([]byte(`{"alg":"HS256","crit":["b64"]}`)) + ".e30.AA"
+	_, err = j.Verify(crit)
+	assert.ErrorContains(t, err, "critical")
+}
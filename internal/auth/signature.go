@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"HTTPFTCP/internal/headers/sfv"
+	"HTTPFTCP/internal/request"
+)
+
+// Signature authenticates requests signed with HTTP Message Signatures
+// (RFC 9421) by a key in Keys, using hmac-sha256, rsa-v1_5-sha256,
+// rsa-pss-sha512 or ed25519. The principal is named after the keyid.
+//
+// When a signature covers Content-Digest (RFC 9530) the body is checked
+// against it too, so covering it signs the body.
+type Signature struct {
+	Keys *KeySet
+	// Required lists the components every accepted signature must cover.
+	// Defaults to "@method" and "@target-uri".
+	Required []string
+	// MaxAge, if set, refuses signatures without a created parameter or
+	// created longer ago than this.
+	MaxAge time.Duration
+	// Tag, if set, only accepts signatures with this tag parameter.
+	Tag string
+	// Scheme is used for @scheme and @target-uri. Defaults to "http".
+	Scheme string
+}
+
+// maxClockSkew is how far in the future a signature's created time may be.
+const maxClockSkew = time.Minute
+
+var defaultRequired = []string{"@method", "@target-uri"}
+
+func (s *Signature) Authenticate(req *request.Request) (*Principal, error) {
+	inputValue, hasInput := req.Headers.Get("Signature-Input")
+	sigValue, hasSig := req.Headers.Get("Signature")
+	if !hasInput && !hasSig {
+		return nil, ErrNoCredentials
+	}
+	inputs, err := sfv.ParseDictionary(inputValue)
+	if err != nil {
+		return nil, fmt.Errorf("%w: Signature-Input: %v", ErrInvalid, err)
+	}
+	sigs, err := sfv.ParseDictionary(sigValue)
+	if err != nil {
+		return nil, fmt.Errorf("%w: Signature: %v", ErrInvalid, err)
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: no signatures", ErrInvalid)
+	}
+
+	// any one good signature is enough; report the first failure
+	var firstErr error
+	for _, in := range inputs {
+		keyID, err := s.verify(req, in, sigs)
+		if err == nil {
+			return &Principal{Name: keyID, Scheme: "signature"}, nil
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%w: signature %q: %v", ErrInvalid, in.Key, err)
+		}
+	}
+	return nil, firstErr
+}
+
+func (s *Signature) Challenge() string {
+	return "Signature"
+}
+
+func (s *Signature) verify(req *request.Request, in sfv.DictMember, sigs sfv.Dictionary) (string, error) {
+	covered, ok := in.Value.(sfv.InnerList)
+	if !ok {
+		return "", errors.New("input is not an inner list")
+	}
+	m, ok := sigs.Get(in.Key)
+	if !ok {
+		return "", errors.New("no matching Signature member")
+	}
+	sigItem, ok := m.(sfv.Item)
+	sig, isBytes := sigItem.Value.([]byte)
+	if !ok || !isBytes {
+		return "", errors.New("signature is not a byte sequence")
+	}
+
+	params := covered.Params
+	keyID, _ := stringParam(params, "keyid")
+	if keyID == "" {
+		return "", errors.New("no keyid")
+	}
+	if s.Tag != "" {
+		if tag, _ := stringParam(params, "tag"); tag != s.Tag {
+			return "", fmt.Errorf("tag %q not accepted", tag)
+		}
+	}
+	if err := s.checkTimes(params); err != nil {
+		return "", err
+	}
+	algs := algorithms
+	if name, ok := stringParam(params, "alg"); ok {
+		alg, ok := httpsigAlgorithm(name)
+		if !ok {
+			return "", fmt.Errorf("unsupported alg %q", name)
+		}
+		algs = []*algorithm{alg}
+	}
+
+	base, err := s.signatureBase(req, covered)
+	if err != nil {
+		return "", err
+	}
+	if !verifyAny(s.Keys, keyID, algs, base, sig) {
+		return "", errors.New("bad signature")
+	}
+	if slices.ContainsFunc(covered.Items, func(it sfv.Item) bool { return it.Value == "content-digest" }) {
+		if err := checkContentDigest(req); err != nil {
+			return "", err
+		}
+	}
+	return keyID, nil
+}
+
+func verifyAny(keys *KeySet, keyID string, algs []*algorithm, base, sig []byte) bool {
+	for _, alg := range algs {
+		for _, k := range keys.candidates(keyID, alg) {
+			if alg.verify(k.key, base, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Signature) checkTimes(params sfv.Params) error {
+	now := time.Now()
+	created, hasCreated := params.Get("created")
+	if hasCreated {
+		c, ok := created.(int64)
+		if !ok {
+			return errors.New("created is not an integer")
+		}
+		t := time.Unix(c, 0)
+		if t.After(now.Add(maxClockSkew)) {
+			return errors.New("created in the future")
+		}
+		if s.MaxAge > 0 && now.Sub(t) > s.MaxAge {
+			return errors.New("signature too old")
+		}
+	} else if s.MaxAge > 0 {
+		return errors.New("no created time")
+	}
+	if expires, ok := params.Get("expires"); ok {
+		e, ok := expires.(int64)
+		if !ok {
+			return errors.New("expires is not an integer")
+		}
+		if !now.Before(time.Unix(e, 0)) {
+			return errors.New("signature expired")
+		}
+	}
+	return nil
+}
+
+// signatureBase builds the signature base of RFC 9421 section 2.5: a line
+// per covered component, then the signature parameters.
+func (s *Signature) signatureBase(req *request.Request, covered sfv.InnerList) ([]byte, error) {
+	required := s.Required
+	if required == nil {
+		required = defaultRequired
+	}
+	for _, name := range required {
+		if !slices.ContainsFunc(covered.Items, func(it sfv.Item) bool { return it.Value == name }) {
+			return nil, fmt.Errorf("%s not covered", name)
+		}
+	}
+
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, it := range covered.Items {
+		id, err := sfv.MarshalItem(it)
+		if err != nil {
+			return nil, err
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("component %s covered twice", id)
+		}
+		seen[id] = true
+		values, err := s.componentValues(req, it)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			b.WriteString(id)
+			b.WriteString(": ")
+			b.WriteString(v)
+			b.WriteByte('\n')
+		}
+	}
+	sigParams, err := sfv.MarshalList(sfv.List{covered})
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(sigParams)
+	return []byte(b.String()), nil
+}
+
+// componentValues returns the value of one covered component. Only
+// @query-param can have more than one, when its name is repeated.
+func (s *Signature) componentValues(req *request.Request, it sfv.Item) ([]string, error) {
+	name, ok := it.Value.(string)
+	if !ok || name == "" || name != strings.ToLower(name) {
+		return nil, fmt.Errorf("bad component identifier %v", it.Value)
+	}
+	if name[0] != '@' {
+		return fieldValue(req, name, it.Params)
+	}
+	paramName, hasName := stringParam(it.Params, "name")
+	if len(it.Params) > 0 && !(name == "@query-param" && hasName && len(it.Params) == 1) {
+		return nil, fmt.Errorf("unsupported parameters on %s", name)
+	}
+
+	u, err := targetURL(req)
+	if err != nil {
+		return nil, err
+	}
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	host, _ := req.Headers.Get("Host")
+	host = strings.ToLower(host)
+	if u.Host != "" {
+		host = strings.ToLower(u.Host)
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	switch name {
+	case "@method":
+		return []string{req.RequestLine.Method}, nil
+	case "@target-uri":
+		uri := scheme + "://" + host + path
+		if u.RawQuery != "" || u.ForceQuery {
+			uri += "?" + u.RawQuery
+		}
+		return []string{uri}, nil
+	case "@authority":
+		return []string{host}, nil
+	case "@scheme":
+		return []string{scheme}, nil
+	case "@request-target":
+		return []string{req.RequestLine.RequestTarget}, nil
+	case "@path":
+		return []string{path}, nil
+	case "@query":
+		return []string{"?" + u.RawQuery}, nil
+	case "@query-param":
+		if !hasName {
+			return nil, fmt.Errorf("@query-param without a name")
+		}
+		return queryParam(u.RawQuery, paramName)
+	}
+	return nil, fmt.Errorf("unsupported component %s", name)
+}
+
+func targetURL(req *request.Request) (*url.URL, error) {
+	target := req.RequestLine.RequestTarget
+	if strings.HasPrefix(target, "/") {
+		return url.ParseRequestURI(target)
+	}
+	return url.Parse(target)
+}
+
+// fieldValue returns a header field's value, or with the key parameter one
+// member of a Dictionary field, re-serialized.
+func fieldValue(req *request.Request, name string, params sfv.Params) ([]string, error) {
+	v, ok := req.Headers.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("covered field %s missing", name)
+	}
+	if len(params) == 0 {
+		return []string{strings.TrimSpace(v)}, nil
+	}
+	key, ok := stringParam(params, "key")
+	if !ok || len(params) != 1 {
+		return nil, fmt.Errorf("unsupported parameters on %s", name)
+	}
+	dict, err := sfv.ParseDictionary(v)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %v", name, err)
+	}
+	m, ok := dict.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("field %s has no member %q", name, key)
+	}
+	var member string
+	switch m := m.(type) {
+	case sfv.Item:
+		member, err = sfv.MarshalItem(m)
+	case sfv.InnerList:
+		member, err = sfv.MarshalList(sfv.List{m})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{member}, nil
+}
+
+// queryParam returns every value of the query parameter name, decoded and
+// then percent-encoded again as RFC 9421 section 2.2.8 describes.
+func queryParam(rawQuery, name string) ([]string, error) {
+	want, err := url.QueryUnescape(name)
+	if err != nil {
+		return nil, fmt.Errorf("bad query parameter name %q", name)
+	}
+	var values []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		if k, err = url.QueryUnescape(k); err != nil || k != want {
+			continue
+		}
+		if v, err = url.QueryUnescape(v); err != nil {
+			return nil, fmt.Errorf("bad query parameter %q", name)
+		}
+		values = append(values, strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("query parameter %q missing", name)
+	}
+	return values, nil
+}
+
+// checkContentDigest compares the body with every sha-256 and sha-512
+// digest in Content-Digest, of which there must be at least one.
+func checkContentDigest(req *request.Request) error {
+	v, _ := req.Headers.Get("Content-Digest")
+	dict, err := sfv.ParseDictionary(v)
+	if err != nil {
+		return fmt.Errorf("Content-Digest: %v", err)
+	}
+	body, err := req.ReadBody()
+	if err != nil {
+		return err
+	}
+	checked := false
+	for _, m := range dict {
+		var sum []byte
+		switch m.Key {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		item, ok := m.Value.(sfv.Item)
+		digest, isBytes := item.Value.([]byte)
+		if !ok || !isBytes || subtle.ConstantTimeCompare(digest, sum) != 1 {
+			return fmt.Errorf("Content-Digest %s does not match the body", m.Key)
+		}
+		checked = true
+	}
+	if !checked {
+		return errors.New("Content-Digest has no supported algorithm")
+	}
+	return nil
+}
+
+func stringParam(params sfv.Params, key string) (string, bool) {
+	v, ok := params.Get(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers/sfv"
+	"HTTPFTCP/internal/request"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcRequest is the example request of RFC 9421 appendix B.2.
+func rfcRequest() *request.Request {
+	req := newRequest("POST", "/foo?param=Value&Pet=dog",
+		"Host", "example.com",
+		"Date", "Tue, 20 Apr 2021 02:07:55 GMT",
+		"Content-Type", "application/json",
+		"Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:",
+		"Content-Length", "18")
+	req.Body = []byte(`{"hello": "world"}`)
+	return req
+}
+
+func TestSignatureRFCExample(t *testing.T) {
+	// Test: RFC 9421 B.2.5, HMAC over date, @authority and content-type
+	ks, err := ParseJWKS([]byte(`{"keys": [{"kty": "oct", "kid": "test-shared-secret",
+		"k": "uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ"}]}`))
+	require.NoError(t, err)
+	s := &Signature{Keys: ks, Required: []string{}}
+	req := rfcRequest()
+	req.Headers.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+	req.Headers.Set("Signature", `sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`)
+	p, err := s.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "test-shared-secret", Scheme: "signature"}, p)
+
+	// Test: Default Required refuses it for not covering the method and URI
+	s.Required = nil
+	_, err = s.Authenticate(req)
+	assert.ErrorContains(t, err, "@method not covered")
+}
+
+func TestSignatureBase(t *testing.T) {
+	// Test: Derived components follow RFC 9421 section 2.2
+	s := &Signature{}
+	req := rfcRequest()
+	req.RequestLine.RequestTarget = "/path/a%2Fb?param=value&foo=bar&baz=batman&qux=&x=this+is%20a+big%0Avalue"
+	req.Headers.Set("Example-Dict", " a=1,    b=2;x=1;y=2,   c=(a   b   c)")
+	covered := `("@method" "@target-uri" "@authority" "@scheme" "@request-target" "@path" "@query" "@query-param";name="baz" "@query-param";name="x" "example-dict";key="c" "content-type");keyid="k"`
+	req.Headers.Set("Signature-Input", "s="+covered)
+	inputs, err := firstInput(req)
+	require.NoError(t, err)
+	base, err := s.signatureBase(req, inputs)
+	require.NoError(t, err)
+	assert.Equal(t, `"@method": POST
+"@target-uri": http://example.com/path/a%2Fb?param=value&foo=bar&baz=batman&qux=&x=this+is%20a+big%0Avalue
+"@authority": example.com
+"@scheme": http
+"@request-target": /path/a%2Fb?param=value&foo=bar&baz=batman&qux=&x=this+is%20a+big%0Avalue
+"@path": /path/a%2Fb
+"@query": ?param=value&foo=bar&baz=batman&qux=&x=this+is%20a+big%0Avalue
+"@query-param";name="baz": batman
+"@query-param";name="x": this%20is%20a%20big%0Avalue
+"example-dict";key="c": (a b c)
+"content-type": application/json
+"@signature-params": `+covered, string(base))
+
+	// Test: Unsupported or malformed components are refused
+	for _, c := range []string{
+		`("@status")`, `("@method";req)`, `("Content-Type")`, `("@query-param")`,
+		`("x-missing")`, `("date" "date")`, `("content-type";sf)`,
+	} {
+		req.Headers.Override("Signature-Input", "s="+c)
+		inputs, err := firstInput(req)
+		require.NoError(t, err)
+		s.Required = []string{}
+		_, err = s.signatureBase(req, inputs)
+		assert.Error(t, err, c)
+	}
+}
+
+// firstInput returns the components covered by the request's first
+// signature.
+func firstInput(req *request.Request) (sfv.InnerList, error) {
+	v, _ := req.Headers.Get("Signature-Input")
+	dict, err := sfv.ParseDictionary(v)
+	if err != nil {
+		return sfv.InnerList{}, err
+	}
+	return dict[0].Value.(sfv.InnerList), nil
+}
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ks, err := ParseJWKS([]byte(fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "client-1", "x": %q}]}`,
+		base64.RawURLEncoding.EncodeToString(pub))))
+	require.NoError(t, err)
+	s := &Signature{Keys: ks, MaxAge: 5 * time.Minute, Tag: "app"}
+
+	body := []byte(`{"amount": 10}`)
+	sum := sha256.Sum256(body)
+	sign := func(params string, mutate func(*request.Request)) *request.Request {
+		req := newRequest("POST", "/pay", "Host", "api.example.com",
+			"Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		req.Body = body
+		covered := `("@method" "@target-uri" "content-digest")` + params
+		req.Headers.Set("Signature-Input", "sig1="+covered)
+		inputs, err := firstInput(req)
+		require.NoError(t, err)
+		base, err := s.signatureBase(req, inputs)
+		require.NoError(t, err)
+		req.Headers.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(ed25519.Sign(priv, base))+":")
+		if mutate != nil {
+			mutate(req)
+		}
+		return req
+	}
+	now := time.Now().Unix()
+	good := fmt.Sprintf(`;created=%d;keyid="client-1";alg="ed25519";tag="app"`, now)
+
+	// Test: Good signature authenticates as the key
+	p, err := s.Authenticate(sign(good, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "client-1", p.Name)
+
+	// Test: Body that doesn't match the signed digest is refused
+	_, err = s.Authenticate(sign(good, func(r *request.Request) { r.Body = []byte(`{"amount": 1000}`) }))
+	assert.ErrorContains(t, err, "does not match the body")
+
+	// Test: Changing a covered component breaks the signature
+	_, err = s.Authenticate(sign(good, func(r *request.Request) { r.RequestLine.RequestTarget = "/refund" }))
+	assert.ErrorContains(t, err, "bad signature")
+
+	// Test: Timing, tag, key and alg parameters are enforced
+	for want, params := range map[string]string{
+		"signature too old":     fmt.Sprintf(`;created=%d;keyid="client-1";tag="app"`, now-600),
+		"created in the future": fmt.Sprintf(`;created=%d;keyid="client-1";tag="app"`, now+600),
+		"signature expired":     fmt.Sprintf(`;created=%d;expires=%d;keyid="client-1";tag="app"`, now, now-1),
+		"no created time":       `;keyid="client-1";tag="app"`,
+		`tag "other"`:           fmt.Sprintf(`;created=%d;keyid="client-1";tag="other"`, now),
+		"no keyid":              fmt.Sprintf(`;created=%d;tag="app"`, now),
+		"bad signature":         fmt.Sprintf(`;created=%d;keyid="client-2";tag="app"`, now),
+		`unsupported alg`:       fmt.Sprintf(`;created=%d;keyid="client-1";alg="hmac-sha1";tag="app"`, now),
+	} {
+		_, err := s.Authenticate(sign(params, nil))
+		assert.ErrorContains(t, err, want)
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+
+	// Test: Missing headers mean no credentials, half of them is invalid
+	_, err = s.Authenticate(newRequest("GET", "/"))
+	assert.ErrorIs(t, err, ErrNoCredentials)
+	_, err = s.Authenticate(newRequest("GET", "/", "Signature", "sig1=:AA==:"))
+	assert.ErrorIs(t, err, ErrInvalid)
+}
@@ -0,0 +1,510 @@
+// Package cache is an HTTP cache (RFC 9111) that sits in front of a handler.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+const defaultMaxEntrySize = 1 << 20
+
+type Options struct {
+	// Private makes this a private cache, which may store responses marked
+	// private and ignores s-maxage. The default is a shared cache.
+	Private bool
+	// MaxEntrySize is the largest body that will be stored. Larger
+	// responses are still passed through. Defaults to 1 MiB.
+	MaxEntrySize int
+	// Name identifies this cache in the Cache-Status header.
+	Name string
+}
+
+// Cache answers requests from a Store where it can and forwards the rest to
+// the handler it wraps.
+type Cache struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+
+	mu           sync.Mutex // guards revalidating and the Variants lists
+	revalidating map[string]bool
+}
+
+func New(store Store, opts Options) *Cache {
+	if opts.MaxEntrySize <= 0 {
+		opts.MaxEntrySize = defaultMaxEntrySize
+	}
+	if opts.Name == "" {
+		opts.Name = "tcptohttp"
+	}
+	return &Cache{
+		store:        store,
+		opts:         opts,
+		now:          time.Now,
+		revalidating: map[string]bool{},
+	}
+}
+
+// Middleware returns next wrapped with the cache.
+func (c *Cache) Middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		c.serve(next, w, req)
+	}
+}
+
+func (c *Cache) serve(next server.Handler, w *response.Writer, req *request.Request) {
+	switch req.RequestLine.Method {
+	case "GET":
+	case "HEAD", "OPTIONS", "TRACE":
+		next(w, req)
+		return
+	default:
+		c.invalidateAfter(next, w, req)
+		return
+	}
+
+	reqCC := parseDirectives(req.Headers)
+	_, hasCacheControl := req.Headers.Get("Cache-Control")
+	if pragma, ok := req.Headers.Get("Pragma"); ok && !hasCacheControl && strings.Contains(pragma, "no-cache") {
+		// HTTP/1.0 clients ask for revalidation this way
+		reqCC["no-cache"] = ""
+	}
+	if reqCC.has("no-store") {
+		next(w, req)
+		return
+	}
+
+	key := primaryKey(req)
+	entry, entryKey := c.lookup(key, req)
+	if entry == nil {
+		if reqCC.has("only-if-cached") {
+			c.writeGatewayTimeout(w)
+			return
+		}
+		c.fetch(next, w, req, reqCC, key)
+		return
+	}
+
+	now := c.now()
+	age := entry.age(now)
+	lifetime := c.freshnessLifetime(entry)
+	respCC := parseDirectives(entry.Headers)
+	if c.satisfies(reqCC, respCC, age, lifetime) {
+		c.serveEntry(w, entry, age, "hit")
+		return
+	}
+	staleness := age - lifetime
+	if !reqCC.has("no-cache") && !respCC.has("no-cache") && !mustRevalidate(respCC, c.opts.Private) {
+		if swr, ok := respCC.seconds("stale-while-revalidate"); ok && staleness <= swr {
+			c.serveEntry(w, entry, age, "hit; detail=stale-while-revalidate")
+			go c.revalidateInBackground(next, req, reqCC, key, entryKey, entry)
+			return
+		}
+	}
+	c.revalidate(next, w, req, reqCC, key, entryKey, entry, staleness)
+}
+
+// satisfies reports whether a stored response of the given age can answer
+// the request without contacting the origin.
+func (c *Cache) satisfies(reqCC, respCC directives, age, lifetime time.Duration) bool {
+	if reqCC.has("no-cache") || respCC.has("no-cache") {
+		return false
+	}
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && age+minFresh >= lifetime {
+		return false
+	}
+	if age < lifetime {
+		return true
+	}
+	if mustRevalidate(respCC, c.opts.Private) || !reqCC.has("max-stale") {
+		return false
+	}
+	maxStale, ok := reqCC.seconds("max-stale")
+	// a bare max-stale accepts any staleness
+	return !ok || age-lifetime <= maxStale
+}
+
+func mustRevalidate(cc directives, private bool) bool {
+	return cc.has("must-revalidate") || (!private && cc.has("proxy-revalidate"))
+}
+
+// primaryKey is the cache key before any Vary fields are taken into account.
+func primaryKey(req *request.Request) string {
+	host, _ := req.Headers.Get("Host")
+	return host + " " + req.RequestLine.RequestTarget
+}
+
+// varyNames returns the normalized field names listed in h's Vary header.
+func varyNames(h headers.Headers) []string {
+	v, ok := h.Get("Vary")
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, name := range headers.SplitList(v) {
+		if name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+func varyValues(names []string, req *request.Request) map[string]string {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		v, _ := req.Headers.Get(name)
+		values[name] = v
+	}
+	return values
+}
+
+func variantKey(key string, names []string, values map[string]string) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\x00%s=%s", name, values[name])
+	}
+	return b.String()
+}
+
+// lookup finds the stored response for req, following Vary to the right
+// variant. It returns the entry and the key it is stored under.
+func (c *Cache) lookup(key string, req *request.Request) (*Entry, string) {
+	entry, ok := c.store.Get(key)
+	if !ok {
+		return nil, ""
+	}
+	if entry.StatusCode != 0 {
+		return entry, key
+	}
+	vkey := variantKey(key, entry.Vary, varyValues(entry.Vary, req))
+	variant, ok := c.store.Get(vkey)
+	if !ok {
+		return nil, ""
+	}
+	return variant, vkey
+}
+
+// save stores rec as the response to req and returns the new entry, or nil
+// if it wasn't stored.
+func (c *Cache) save(key string, req *request.Request, reqCC directives, rec *response.Recorder, requestTime, responseTime time.Time) *Entry {
+	if !c.storable(reqCC, req.Headers, rec) {
+		return nil
+	}
+	entry := &Entry{
+		StatusCode:   rec.StatusCode,
+		Reason:       rec.Reason,
+		Headers:      headers.NewHeaders(),
+		Body:         append([]byte(nil), rec.Body.Bytes()...),
+		Chunked:      rec.Chunked,
+		Trailers:     rec.Trailers,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	for k, v := range rec.Headers {
+		entry.Headers[k] = v
+	}
+	names := varyNames(entry.Headers)
+	if len(names) == 0 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// a response that used to vary leaves its variants behind
+		if old, ok := c.store.Get(key); ok {
+			c.invalidateVariants(old)
+		}
+		c.set(key, entry)
+		return entry
+	}
+	entry.Vary = names
+	entry.VaryValues = varyValues(names, req)
+	c.setVariant(key, names, variantKey(key, names, entry.VaryValues), entry)
+	return entry
+}
+
+// setVariant stores entry under vkey and records vkey in the entry under
+// the primary key, so that all the variants can be found again to
+// invalidate them. If the response used to vary on other fields, the
+// variants stored for those are dropped. Both writes happen under c.mu, so
+// an invalidation can't land between them.
+func (c *Cache) setVariant(key string, names []string, vkey string, entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var variants []string
+	if old, ok := c.store.Get(key); ok {
+		if old.StatusCode == 0 && slices.Equal(old.Vary, names) {
+			variants = slices.Clone(old.Variants)
+		} else {
+			c.invalidateVariants(old)
+		}
+	}
+	if !slices.Contains(variants, vkey) {
+		variants = append(variants, vkey)
+	}
+	c.set(key, &Entry{Vary: names, Variants: variants})
+	c.set(vkey, entry)
+}
+
+func (c *Cache) invalidateVariants(e *Entry) {
+	for _, vkey := range e.Variants {
+		c.store.Delete(vkey)
+	}
+}
+
+func (c *Cache) set(key string, e *Entry) {
+	if err := c.store.Set(key, e); err != nil {
+		log.Printf("cache: error storing %q: %v", key, err)
+	}
+}
+
+// fetch forwards a request we have nothing stored for, streaming the
+// response to the client while keeping a copy to store.
+func (c *Cache) fetch(next server.Handler, w *response.Writer, req *request.Request, reqCC directives, key string) {
+	requestTime := c.now()
+	tee := &teeSink{Writer: w, limit: c.opts.MaxEntrySize, status: c.cacheStatus("fwd=uri-miss")}
+	tee.rec, tee.recWriter = response.NewRecorder()
+	next(response.NewSinkWriter(tee), req)
+	if tee.overflow || tee.rec.StatusCode == 0 {
+		return
+	}
+	c.save(key, req, reqCC, tee.rec, requestTime, c.now())
+}
+
+// revalidate asks the origin whether entry is still good, answering from
+// the cache on 304 and, where allowed, when the origin fails.
+func (c *Cache) revalidate(next server.Handler, w *response.Writer, req *request.Request, reqCC directives, key, entryKey string, entry *Entry, staleness time.Duration) {
+	requestTime := c.now()
+	rec, rw := response.NewRecorder()
+	next(rw, conditionalRequest(req, entry))
+	responseTime := c.now()
+
+	switch {
+	case rec.StatusCode == response.StatusCodeNotModified:
+		entry = c.freshen(entryKey, entry, rec, requestTime, responseTime)
+		c.serveEntry(w, entry, entry.age(c.now()), "hit; fwd=stale; fwd-status=304")
+		return
+	case rec.StatusCode >= 500 && c.staleIfError(reqCC, entry, staleness):
+		c.serveEntry(w, entry, entry.age(c.now()), fmt.Sprintf("hit; fwd=stale; fwd-status=%d; detail=stale-if-error", rec.StatusCode))
+		return
+	}
+
+	c.save(key, req, reqCC, rec, requestTime, responseTime)
+	setHeader(rec, "Cache-Status", c.cacheStatus(fmt.Sprintf("fwd=stale; fwd-status=%d", rec.StatusCode)))
+	if err := rec.Replay(w); err != nil {
+		log.Printf("cache: error writing response: %v", err)
+	}
+}
+
+func (c *Cache) revalidateInBackground(next server.Handler, req *request.Request, reqCC directives, key, entryKey string, entry *Entry) {
+	c.mu.Lock()
+	if c.revalidating[entryKey] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[entryKey] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.revalidating, entryKey)
+		c.mu.Unlock()
+	}()
+
+	requestTime := c.now()
+	rec, rw := response.NewRecorder()
+	creq := conditionalRequest(req, entry)
+	// the client's own response has gone by now, so its hanging up
+	// mustn't cut the revalidation short
+	creq.SetContext(context.WithoutCancel(req.Context()))
+	next(rw, creq)
+	responseTime := c.now()
+	if rec.StatusCode == response.StatusCodeNotModified {
+		c.freshen(entryKey, entry, rec, requestTime, responseTime)
+		return
+	}
+	if rec.StatusCode >= 500 {
+		return
+	}
+	c.save(key, req, reqCC, rec, requestTime, responseTime)
+}
+
+func (c *Cache) staleIfError(reqCC directives, entry *Entry, staleness time.Duration) bool {
+	respCC := parseDirectives(entry.Headers)
+	if mustRevalidate(respCC, c.opts.Private) {
+		return false
+	}
+	for _, cc := range []directives{reqCC, respCC} {
+		if d, ok := cc.seconds("stale-if-error"); ok && staleness <= d {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalRequest copies req with validators from entry so the origin
+// can answer 304 if it hasn't changed.
+func conditionalRequest(req *request.Request, entry *Entry) *request.Request {
+	creq := req.Clone()
+	delete(creq.Headers, "if-none-match")
+	delete(creq.Headers, "if-modified-since")
+	delete(creq.Headers, "if-match")
+	delete(creq.Headers, "if-unmodified-since")
+	delete(creq.Headers, "if-range")
+	if etag, ok := entry.Headers.Get("ETag"); ok {
+		creq.Headers.Override("If-None-Match", etag)
+	}
+	if lm, ok := entry.Headers.Get("Last-Modified"); ok {
+		creq.Headers.Override("If-Modified-Since", lm)
+	}
+	return creq
+}
+
+// freshen updates a stored entry with the headers of a 304 response, as in
+// RFC 9111 section 4.3.4.
+func (c *Cache) freshen(entryKey string, entry *Entry, rec *response.Recorder, requestTime, responseTime time.Time) *Entry {
+	updated := *entry
+	updated.Headers = headers.NewHeaders()
+	for k, v := range entry.Headers {
+		updated.Headers[k] = v
+	}
+	for k, v := range rec.Headers {
+		switch k {
+		case "content-length", "transfer-encoding", "trailer", "connection", "content-encoding":
+			continue
+		}
+		updated.Headers.Override(k, v)
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = responseTime
+	c.set(entryKey, &updated)
+	return &updated
+}
+
+// invalidateAfter runs an unsafe request and drops what we have stored for
+// its target, every variant included, if it succeeded (RFC 9111 section
+// 4.4).
+func (c *Cache) invalidateAfter(next server.Handler, w *response.Writer, req *request.Request) {
+	sniff := &statusSink{Writer: w}
+	next(response.NewSinkWriter(sniff), req)
+	if sniff.statusCode >= 200 && sniff.statusCode < 400 {
+		key := primaryKey(req)
+		c.mu.Lock()
+		if e, ok := c.store.Get(key); ok {
+			c.invalidateVariants(e)
+		}
+		c.store.Delete(key)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Cache) serveEntry(w *response.Writer, entry *Entry, age time.Duration, status string) {
+	rec := entry.recorder()
+	setHeader(rec, "Age", strconv.FormatInt(int64(age/time.Second), 10))
+	setHeader(rec, "Cache-Status", c.cacheStatus(status))
+	if err := rec.Replay(w); err != nil {
+		log.Printf("cache: error writing response: %v", err)
+	}
+}
+
+func (c *Cache) writeGatewayTimeout(w *response.Writer) {
+	w.WriteStatusLine(response.StatusCodeGatewayTimeout)
+	body := []byte("Not in cache")
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Cache-Status", c.cacheStatus("fwd=miss"))
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func (c *Cache) cacheStatus(params string) string {
+	return c.opts.Name + "; " + params
+}
+
+func setHeader(rec *response.Recorder, key, value string) {
+	if rec.Headers == nil {
+		rec.Headers = headers.NewHeaders()
+	}
+	rec.Headers.Override(key, value)
+}
+
+// teeSink passes a response through to the client while recording up to
+// limit bytes of it.
+type teeSink struct {
+	*response.Writer
+	rec       *response.Recorder
+	recWriter *response.Writer
+	limit     int
+	overflow  bool
+	status    string
+}
+
+func (t *teeSink) WriteStatusLineWithReason(statusCode response.StatusCode, reason string) error {
+	t.recWriter.WriteStatusLineWithReason(statusCode, reason)
+	return t.Writer.WriteStatusLineWithReason(statusCode, reason)
+}
+
+func (t *teeSink) AddHeaderLine(key, value string) error {
+	t.recWriter.AddHeaderLine(key, value)
+	return t.Writer.AddHeaderLine(key, value)
+}
+
+func (t *teeSink) WriteHeaders(h headers.Headers) error {
+	t.recWriter.WriteHeaders(h)
+	h.Override("Cache-Status", t.status)
+	return t.Writer.WriteHeaders(h)
+}
+
+func (t *teeSink) WriteBody(p []byte) (int, error) {
+	t.record(p, t.recWriter.WriteBody)
+	return t.Writer.WriteBody(p)
+}
+
+func (t *teeSink) WriteChunkedBody(p []byte) (int, error) {
+	t.record(p, t.recWriter.WriteChunkedBody)
+	return t.Writer.WriteChunkedBody(p)
+}
+
+func (t *teeSink) WriteChunkedBodyDone() (int, error) {
+	t.recWriter.WriteChunkedBodyDone()
+	return t.Writer.WriteChunkedBodyDone()
+}
+
+func (t *teeSink) WriteTrailers(h headers.Headers) error {
+	t.recWriter.WriteTrailers(h)
+	return t.Writer.WriteTrailers(h)
+}
+
+func (t *teeSink) record(p []byte, write func([]byte) (int, error)) {
+	if t.overflow {
+		return
+	}
+	if t.rec.Body.Len()+len(p) > t.limit {
+		// too big to keep; stop recording and let go of what we have
+		t.overflow = true
+		t.rec.Body.Reset()
+		return
+	}
+	write(p)
+}
+
+// statusSink passes a response through, noting its status code.
+type statusSink struct {
+	*response.Writer
+	statusCode response.StatusCode
+}
+
+func (s *statusSink) WriteStatusLineWithReason(statusCode response.StatusCode, reason string) error {
+	s.statusCode = statusCode
+	return s.Writer.WriteStatusLineWithReason(statusCode, reason)
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// origin is a handler that counts calls and answers with whatever status,
+// headers and body the test sets.
+type origin struct {
+	calls   int
+	status  response.StatusCode
+	headers map[string]string
+	body    string
+	lastReq *request.Request
+}
+
+func (o *origin) handle(w *response.Writer, req *request.Request) {
+	o.calls++
+	o.lastReq = req
+	w.WriteStatusLine(o.status)
+	h := response.GetDefaultHeaders(len(o.body))
+	for k, v := range o.headers {
+		h.Override(k, v)
+	}
+	w.WriteHeaders(h)
+	if o.body != "" {
+		w.WriteBody([]byte(o.body))
+	}
+}
+
+func newRequest(t *testing.T, method, target string, extra headers.Headers) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	req.Headers.Set("Host", "localhost")
+	for k, v := range extra {
+		req.Headers.Override(k, v)
+	}
+	return req
+}
+
+func do(h func(*response.Writer, *request.Request), req *request.Request) string {
+	var buf bytes.Buffer
+	h(response.NewWriter(&buf), req)
+	return buf.String()
+}
+
+func newTestCache() (*Cache, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(NewMemoryStore(1<<20), Options{})
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestFreshHit(t *testing.T) {
+	c, now := newTestCache()
+	o := &origin{status: response.StatusCodeSuccess, headers: map[string]string{"Cache-Control": "max-age=60"}, body: "hello"}
+	h := c.Middleware(o.handle)
+
+	// Test: Miss goes to origin
+	out := do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 1, o.calls)
+	assert.Contains(t, out, "cache-status: tcptohttp; fwd=uri-miss")
+
+	// Test: Fresh entry is served without origin
+	*now = now.Add(30 * time.Second)
+	out = do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 1, o.calls)
+	assert.Contains(t, out, "age: 30\r\n")
+	assert.Contains(t, out, "hello")
+
+	// Test: Request no-cache forces revalidation
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"cache-control": "no-cache"}))
+	assert.Equal(t, 2, o.calls)
+
+	// Test: Unsafe method invalidates
+	do(h, newRequest(t, "POST", "/a", nil))
+	do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 4, o.calls)
+}
+
+func TestRevalidation(t *testing.T) {
+	c, now := newTestCache()
+	o := &origin{status: response.StatusCodeSuccess, headers: map[string]string{"Cache-Control": "max-age=10", "ETag": `"v1"`}, body: "hello"}
+	h := c.Middleware(o.handle)
+	do(h, newRequest(t, "GET", "/a", nil))
+
+	// Test: Stale entry is revalidated with If-None-Match and reused on 304
+	*now = now.Add(20 * time.Second)
+	o.status = response.StatusCodeNotModified
+	o.body = ""
+	out := do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 2, o.calls)
+	inm, _ := o.lastReq.Headers.Get("If-None-Match")
+	assert.Equal(t, `"v1"`, inm)
+	assert.Contains(t, out, "HTTP/1.1 200 OK")
+	assert.Contains(t, out, "hello")
+
+	// Test: Freshened entry is a hit again
+	do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 2, o.calls)
+
+	// Test: Revalidating for the client keeps its context, and so its
+	// deadline
+	*now = now.Add(20 * time.Second)
+	req := newRequest(t, "GET", "/a", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req.SetContext(ctx)
+	do(h, req)
+	assert.Equal(t, 3, o.calls)
+	assert.Equal(t, ctx, o.lastReq.Context())
+
+	// Test: stale-if-error serves the stored response when origin fails
+	o.headers["Cache-Control"] = "max-age=10, stale-if-error=60"
+	o.status = response.StatusCodeSuccess
+	o.body = "hello"
+	do(h, newRequest(t, "GET", "/b", nil))
+	*now = now.Add(30 * time.Second)
+	o.status = response.StatusCodeBadGateway
+	out = do(h, newRequest(t, "GET", "/b", nil))
+	assert.Contains(t, out, "HTTP/1.1 200 OK")
+	assert.Contains(t, out, "detail=stale-if-error")
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c, now := newTestCache()
+	o := &origin{status: response.StatusCodeSuccess, headers: map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=30", "ETag": `"v1"`}, body: "hello"}
+	served := make(chan struct{}, 4)
+	h := c.Middleware(func(w *response.Writer, req *request.Request) {
+		o.handle(w, req)
+		served <- struct{}{}
+	})
+	// settled waits for the origin to answer and any revalidation in the
+	// background to be stored.
+	settled := func() {
+		<-served
+		require.Eventually(t, func() bool {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return len(c.revalidating) == 0
+		}, 5*time.Second, time.Millisecond)
+	}
+	do(h, newRequest(t, "GET", "/a", nil))
+	settled()
+
+	// Test: Within the window the stale entry is served straight away and
+	// revalidated in the background
+	*now = now.Add(20 * time.Second)
+	o.headers["ETag"] = `"v2"`
+	o.body = "hello again"
+	out := do(h, newRequest(t, "GET", "/a", nil))
+	assert.Contains(t, out, "age: 20\r\n")
+	assert.Contains(t, out, "detail=stale-while-revalidate")
+	assert.True(t, strings.HasSuffix(out, "hello"))
+	settled()
+	assert.Equal(t, 2, o.calls)
+	inm, _ := o.lastReq.Headers.Get("If-None-Match")
+	assert.Equal(t, `"v1"`, inm)
+
+	// Test: The next request gets what the revalidation stored
+	out = do(h, newRequest(t, "GET", "/a", nil))
+	assert.Equal(t, 2, o.calls)
+	assert.True(t, strings.HasSuffix(out, "hello again"))
+
+	// Test: Past the window it is revalidated before answering
+	*now = now.Add(time.Minute)
+	o.body = "hello once more"
+	out = do(h, newRequest(t, "GET", "/a", nil))
+	<-served
+	assert.Equal(t, 3, o.calls)
+	assert.True(t, strings.HasSuffix(out, "hello once more"))
+}
+
+func TestVaryAndNoStore(t *testing.T) {
+	c, _ := newTestCache()
+	o := &origin{status: response.StatusCodeSuccess, headers: map[string]string{"Cache-Control": "max-age=60", "Vary": "Accept-Language"}, body: "hello"}
+	h := c.Middleware(o.handle)
+
+	// Test: Variants are stored separately
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "en"}))
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "fr"}))
+	assert.Equal(t, 2, o.calls)
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "en"}))
+	assert.Equal(t, 2, o.calls)
+
+	// Test: Unsafe method invalidates every variant
+	do(h, newRequest(t, "POST", "/a", nil))
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "en"}))
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "fr"}))
+	assert.Equal(t, 5, o.calls)
+
+	// Test: A response that stops varying drops the old variants
+	en := newRequest(t, "GET", "/a", headers.Headers{"accept-language": "en"})
+	vkey := variantKey(primaryKey(en), []string{"accept-language"}, varyValues([]string{"accept-language"}, en))
+	_, ok := c.store.Get(vkey)
+	require.True(t, ok)
+	delete(o.headers, "Vary")
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "en", "cache-control": "no-cache"}))
+	assert.Equal(t, 6, o.calls)
+	_, ok = c.store.Get(vkey)
+	assert.False(t, ok)
+	do(h, newRequest(t, "GET", "/a", headers.Headers{"accept-language": "fr"}))
+	assert.Equal(t, 6, o.calls)
+
+	// Test: no-store responses are never stored
+	o.headers = map[string]string{"Cache-Control": "no-store"}
+	do(h, newRequest(t, "GET", "/b", nil))
+	do(h, newRequest(t, "GET", "/b", nil))
+	assert.Equal(t, 8, o.calls)
+
+	// Test: private responses are not stored by a shared cache
+	o.headers = map[string]string{"Cache-Control": "private, max-age=60"}
+	do(h, newRequest(t, "GET", "/c", nil))
+	do(h, newRequest(t, "GET", "/c", nil))
+	assert.Equal(t, 10, o.calls)
+}
+
+func TestStores(t *testing.T) {
+	entry := func(body string) *Entry {
+		return &Entry{StatusCode: 200, Headers: headers.Headers{"x": "y"}, Body: []byte(body)}
+	}
+
+	// Test: Memory store evicts least recently used
+	m := NewMemoryStore(30)
+	require.NoError(t, m.Set("a", entry("0123456789")))
+	require.NoError(t, m.Set("b", entry("0123456789")))
+	_, ok := m.Get("a")
+	assert.True(t, ok)
+	require.NoError(t, m.Set("c", entry("0123456789")))
+	_, ok = m.Get("b")
+	assert.False(t, ok)
+	_, ok = m.Get("a")
+	assert.True(t, ok)
+
+	// Test: Disk store survives reopening and evicts by size
+	dir := t.TempDir()
+	d, err := NewDiskStore(dir, 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, d.Set("a", entry("hello")))
+	d, err = NewDiskStore(dir, 1<<20)
+	require.NoError(t, err)
+	e, ok := d.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "hello", string(e.Body))
+	d.Delete("a")
+	_, ok = d.Get("a")
+	assert.False(t, ok)
+
+	small, err := NewDiskStore(t.TempDir(), 300)
+	require.NoError(t, err)
+	require.NoError(t, small.Set("a", entry("0123456789")))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, small.Set("b", entry("0123456789")))
+	_, ok = small.Get("a")
+	assert.False(t, ok)
+	_, ok = small.Get("b")
+	assert.True(t, ok)
+}
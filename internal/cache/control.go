@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"strings"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/response"
+)
+
+// directives holds parsed Cache-Control directives. Names are lowercased;
+// directives without an argument map to "".
+type directives map[string]string
+
+func parseDirectives(h headers.Headers) directives {
+	d := directives{}
+	v, ok := h.Get("Cache-Control")
+	if !ok {
+		return d
+	}
+	for _, part := range headers.SplitList(v) {
+		name, arg, _ := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		d[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the delta-seconds argument of name. Malformed arguments
+// are treated as absent.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := headers.ParseNonNegativeInt(arg)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// heuristicStatus lists the status codes that may be cached without
+// explicit freshness information (RFC 9110 section 15.1).
+var heuristicStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+const maxHeuristicLifetime = 24 * time.Hour
+
+// freshnessLifetime implements RFC 9111 section 4.2.1.
+func (c *Cache) freshnessLifetime(e *Entry) time.Duration {
+	cc := parseDirectives(e.Headers)
+	if !c.opts.Private {
+		if d, ok := cc.seconds("s-maxage"); ok {
+			return d
+		}
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	date := e.date()
+	if v, ok := e.Headers.Get("Expires"); ok {
+		expires, err := headers.ParseHTTPDate(v)
+		if err != nil {
+			// an invalid Expires means already expired
+			return 0
+		}
+		return max(expires.Sub(date), 0)
+	}
+	if !heuristicStatus[int(e.StatusCode)] {
+		return 0
+	}
+	if lm, ok := e.Headers.GetTime("Last-Modified"); ok && lm.Before(date) {
+		return min(date.Sub(lm)/10, maxHeuristicLifetime)
+	}
+	return 0
+}
+
+// storable reports whether a response to req may be stored, following
+// RFC 9111 section 3.
+func (c *Cache) storable(reqCC directives, reqHeaders headers.Headers, rec *response.Recorder) bool {
+	if reqCC.has("no-store") {
+		return false
+	}
+	cc := parseDirectives(rec.Headers)
+	if cc.has("no-store") {
+		return false
+	}
+	if !c.opts.Private && cc.has("private") {
+		return false
+	}
+	if _, ok := reqHeaders.Get("Authorization"); ok && !c.opts.Private {
+		if !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+			return false
+		}
+	}
+	if v, ok := rec.Headers.Get("Vary"); ok && strings.TrimSpace(v) == "*" {
+		return false
+	}
+	for _, l := range rec.HeaderLines {
+		if strings.EqualFold(l.Key, "Set-Cookie") {
+			// never hand one client's cookies to another
+			return false
+		}
+	}
+	if rec.StatusCode < 200 || rec.StatusCode == 206 || rec.StatusCode == 304 {
+		return false
+	}
+	if _, ok := rec.Headers.Get("Expires"); ok {
+		return true
+	}
+	if cc.has("max-age") || cc.has("public") || (!c.opts.Private && cc.has("s-maxage")) {
+		return true
+	}
+	return heuristicStatus[int(rec.StatusCode)]
+}
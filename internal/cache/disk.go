@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const diskEntrySuffix = ".entry"
+
+// DiskStore is a Store that keeps one file per entry in a directory. Once
+// the files add up to more than its limit the least recently used ones are
+// removed.
+type DiskStore struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	files    map[string]*diskFile
+}
+
+type diskFile struct {
+	size int64
+	used time.Time
+}
+
+// diskRecord is what is written to each file. The key is kept so a hash
+// collision reads as a miss rather than the wrong response.
+type diskRecord struct {
+	Key   string
+	Entry *Entry
+}
+
+// NewDiskStore opens dir, creating it if needed, and picks up any entries
+// left from a previous run.
+func NewDiskStore(dir string, maxBytes int64) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	d := &DiskStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+		files:    map[string]*diskFile{},
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), diskEntrySuffix) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		d.files[de.Name()] = &diskFile{size: info.Size(), used: info.ModTime()}
+		d.size += info.Size()
+	}
+	d.mu.Lock()
+	d.evict()
+	d.mu.Unlock()
+	return d, nil
+}
+
+func (d *DiskStore) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + diskEntrySuffix
+}
+
+func (d *DiskStore) Get(key string) (*Entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := d.fileName(key)
+	f, ok := d.files[name]
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(d.dir, name))
+	if err != nil {
+		d.forget(name)
+		return nil, false
+	}
+	var rec diskRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Key != key || rec.Entry == nil {
+		return nil, false
+	}
+	f.used = time.Now()
+	// the modification time doubles as the last-used time across restarts
+	_ = os.Chtimes(filepath.Join(d.dir, name), f.used, f.used)
+	return rec.Entry, true
+}
+
+func (d *DiskStore) Set(key string, e *Entry) error {
+	data, err := json.Marshal(diskRecord{Key: key, Entry: e})
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := d.fileName(key)
+	d.forget(name)
+	if int64(len(data)) > d.maxBytes {
+		return nil
+	}
+	// write to a temp file first so a crash never leaves half an entry
+	tmp, err := os.CreateTemp(d.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	d.files[name] = &diskFile{size: int64(len(data)), used: time.Now()}
+	d.size += int64(len(data))
+	d.evict()
+	return nil
+}
+
+func (d *DiskStore) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forget(d.fileName(key))
+}
+
+// forget removes name from disk and the index. d.mu must be held.
+func (d *DiskStore) forget(name string) {
+	f, ok := d.files[name]
+	if !ok {
+		return
+	}
+	err := os.Remove(filepath.Join(d.dir, name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	delete(d.files, name)
+	d.size -= f.size
+}
+
+// evict drops least recently used files until the store fits. d.mu must be
+// held.
+func (d *DiskStore) evict() {
+	if d.size <= d.maxBytes {
+		return
+	}
+	names := make([]string, 0, len(d.files))
+	for name := range d.files {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return d.files[a].used.Compare(d.files[b].used)
+	})
+	for _, name := range names {
+		if d.size <= d.maxBytes {
+			return
+		}
+		d.forget(name)
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/response"
+)
+
+// Entry is a stored response plus what's needed to work out its age.
+type Entry struct {
+	StatusCode   response.StatusCode
+	Reason       string
+	Headers      headers.Headers
+	Body         []byte
+	Chunked      bool
+	Trailers     headers.Headers
+	RequestTime  time.Time
+	ResponseTime time.Time
+
+	// Vary lists the request fields the response varies on and VaryValues
+	// their values on the request that produced it. An entry stored under
+	// the primary key with only Vary set points at the per-variant entries,
+	// whose keys it lists in Variants.
+	Vary       []string
+	VaryValues map[string]string
+	Variants   []string
+}
+
+// Size is roughly how many bytes the entry takes up, used for eviction.
+func (e *Entry) Size() int64 {
+	n := int64(len(e.Body)) + int64(len(e.Reason))
+	for k, v := range e.Headers {
+		n += int64(len(k) + len(v))
+	}
+	for k, v := range e.Trailers {
+		n += int64(len(k) + len(v))
+	}
+	for k, v := range e.VaryValues {
+		n += int64(len(k) + len(v))
+	}
+	for _, k := range e.Variants {
+		n += int64(len(k))
+	}
+	return n
+}
+
+func (e *Entry) date() time.Time {
+	if d, ok := e.Headers.GetTime("Date"); ok {
+		return d
+	}
+	return e.ResponseTime
+}
+
+// age implements the current_age calculation in RFC 9111 section 4.2.3.
+func (e *Entry) age(now time.Time) time.Duration {
+	apparentAge := max(e.ResponseTime.Sub(e.date()), 0)
+	var ageValue time.Duration
+	if n, ok, err := e.Headers.GetInt("Age"); ok && err == nil {
+		ageValue = time.Duration(n) * time.Second
+	}
+	correctedAgeValue := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	correctedInitialAge := max(apparentAge, correctedAgeValue)
+	residentTime := now.Sub(e.ResponseTime)
+	return correctedInitialAge + residentTime
+}
+
+func (e *Entry) recorder() *response.Recorder {
+	rec := &response.Recorder{
+		StatusCode: e.StatusCode,
+		Reason:     e.Reason,
+		Headers:    headers.NewHeaders(),
+		Chunked:    e.Chunked,
+		Trailers:   e.Trailers,
+	}
+	for k, v := range e.Headers {
+		rec.Headers[k] = v
+	}
+	rec.Body.Write(e.Body)
+	return rec
+}
+
+// Store keeps cache entries. Implementations must be safe for concurrent use.
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, e *Entry) error
+	Delete(key string)
+}
+
+// MemoryStore is an in-memory Store that evicts the least recently used
+// entries once the total size passes its limit.
+type MemoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (m *MemoryStore) Get(key string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (m *MemoryStore) Set(key string, e *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(key)
+	item := &memoryItem{key: key, entry: e, size: e.Size() + int64(len(key))}
+	if item.size > m.maxBytes {
+		return nil
+	}
+	m.entries[key] = m.lru.PushFront(item)
+	m.size += item.size
+	for m.size > m.maxBytes {
+		oldest := m.lru.Back()
+		m.remove(oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(key)
+}
+
+func (m *MemoryStore) remove(key string) {
+	el, ok := m.entries[key]
+	if !ok {
+		return
+	}
+	m.lru.Remove(el)
+	delete(m.entries, key)
+	m.size -= el.Value.(*memoryItem).size
+}
@@ -0,0 +1,222 @@
+// Package compress is middleware that compresses response bodies with
+// whichever of gzip, deflate or zstd the client prefers.
+package compress
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+const defaultMinSize = 1024
+
+// chunkBufferSize is how much compressed output is gathered into each chunk.
+const chunkBufferSize = 8 << 10
+
+type Options struct {
+	// MinSize is the smallest Content-Length worth compressing. Bodies
+	// without a Content-Length are always compressed. Defaults to 1024.
+	MinSize int
+	// Encodings lists the codings to offer, most preferred first. It is used
+	// to break ties between codings the client likes equally. Defaults to
+	// zstd, gzip, deflate.
+	Encodings []string
+	// SkipTypes lists media types, or type prefixes ending in "/", that are
+	// already compressed. Defaults to common image, audio, video and archive
+	// formats.
+	SkipTypes []string
+}
+
+var defaultEncodings = []string{"zstd", "gzip", "deflate"}
+
+var defaultSkipTypes = []string{
+	"image/", "audio/", "video/",
+	"application/gzip", "application/zip", "application/zstd",
+	"application/x-7z-compressed", "application/x-bzip2", "application/x-xz",
+	"application/x-rar-compressed", "font/woff", "font/woff2",
+}
+
+func Middleware(opts Options) server.Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultMinSize
+	}
+	if len(opts.Encodings) == 0 {
+		opts.Encodings = defaultEncodings
+	}
+	if opts.SkipTypes == nil {
+		opts.SkipTypes = defaultSkipTypes
+	}
+	for _, enc := range opts.Encodings {
+		if _, ok := pools[enc]; !ok {
+			panic(fmt.Sprintf("compress: unsupported encoding %q", enc))
+		}
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			if req.RequestLine.Method == "HEAD" {
+				// HEAD gets the headers GET would, so negotiate as usual
+				// and throw away whatever body comes out
+				w = response.DiscardBody(w)
+			}
+			encoding, ok := req.Headers.NegotiateEncoding(opts.Encodings...)
+			if !ok {
+				// nothing is acceptable, not even identity; sending it
+				// anyway beats a 406 for a body the handler already chose
+				encoding = "identity"
+			}
+			cs := &compressSink{
+				Writer:   w,
+				opts:     &opts,
+				encoding: encoding,
+			}
+			next(response.NewSinkWriter(cs), req)
+			if err := cs.finish(); err != nil {
+				log.Printf("compress: error finishing body: %v", err)
+			}
+		}
+	}
+}
+
+// compressSink decides once the headers arrive whether to compress, then
+// feeds the body through an encoder and sends the result as chunks.
+type compressSink struct {
+	*response.Writer
+	opts       *Options
+	encoding   string
+	statusCode response.StatusCode
+
+	enc      encoder
+	buf      *bufio.Writer
+	finished bool
+}
+
+func (c *compressSink) WriteStatusLineWithReason(statusCode response.StatusCode, reason string) error {
+	c.statusCode = statusCode
+	return c.Writer.WriteStatusLineWithReason(statusCode, reason)
+}
+
+func (c *compressSink) WriteHeaders(h headers.Headers) error {
+	if !c.eligible(h) {
+		return c.Writer.WriteHeaders(h)
+	}
+	h.AddVary("Accept-Encoding")
+	if c.encoding == "identity" {
+		return c.Writer.WriteHeaders(h)
+	}
+
+	delete(h, "content-length")
+	h.Override("Content-Encoding", c.encoding)
+	h.Override("Transfer-Encoding", "chunked")
+	if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+		// the compressed bytes are a different representation
+		h.Override("ETag", "W/"+etag)
+	}
+	if err := c.Writer.WriteHeaders(h); err != nil {
+		return err
+	}
+	c.buf = bufio.NewWriterSize(chunkWriter{c.Writer}, chunkBufferSize)
+	c.enc = pools[c.encoding].get(c.buf)
+	return nil
+}
+
+// eligible reports whether a response with headers h may be compressed at
+// all, regardless of what the client accepts.
+func (c *compressSink) eligible(h headers.Headers) bool {
+	switch c.statusCode {
+	case response.StatusCodeNoContent, response.StatusCodePartialContent, response.StatusCodeNotModified:
+		// a byte range is of the uncompressed representation
+		return false
+	}
+	if c.statusCode < 200 {
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	if te, ok := h.Get("Transfer-Encoding"); ok && !strings.EqualFold(strings.TrimSpace(te), "chunked") {
+		return false
+	}
+	if cc, ok := h.Get("Cache-Control"); ok && strings.Contains(strings.ToLower(cc), "no-transform") {
+		return false
+	}
+	if n, ok, err := h.GetInt("Content-Length"); ok && (err != nil || n < int64(c.opts.MinSize)) {
+		return false
+	}
+	mediaType, _, _ := h.GetMediaType()
+	for _, skip := range c.opts.SkipTypes {
+		if mediaType == skip || (strings.HasSuffix(skip, "/") && strings.HasPrefix(mediaType, skip)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compressSink) WriteBody(p []byte) (int, error) {
+	if c.enc == nil {
+		return c.Writer.WriteBody(p)
+	}
+	return c.enc.Write(p)
+}
+
+func (c *compressSink) WriteChunkedBody(p []byte) (int, error) {
+	if c.enc == nil {
+		return c.Writer.WriteChunkedBody(p)
+	}
+	return c.enc.Write(p)
+}
+
+func (c *compressSink) WriteChunkedBodyDone() (int, error) {
+	if c.enc == nil {
+		return c.Writer.WriteChunkedBodyDone()
+	}
+	if err := c.closeEncoder(); err != nil {
+		return 0, err
+	}
+	c.finished = true
+	return c.Writer.WriteChunkedBodyDone()
+}
+
+// finish ends a compressed body the handler didn't end itself, which is
+// the case whenever it wrote a plain body.
+func (c *compressSink) finish() error {
+	if c.enc == nil || c.finished {
+		return nil
+	}
+	if err := c.closeEncoder(); err != nil {
+		return err
+	}
+	c.finished = true
+	if _, err := c.Writer.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return c.Writer.WriteTrailers(headers.NewHeaders())
+}
+
+func (c *compressSink) closeEncoder() error {
+	err := c.enc.Close()
+	pools[c.encoding].put(c.enc)
+	c.enc = nil
+	if err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+// chunkWriter sends each write as a chunk.
+type chunkWriter struct {
+	w *response.Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		// a zero-length chunk would end the body
+		return 0, nil
+	}
+	return cw.w.WriteChunkedBody(p)
+}
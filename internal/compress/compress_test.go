@@ -0,0 +1,136 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, acceptEncoding, contentType, body string) *response.Recorder {
+	t.Helper()
+	return serveMethod(t, "GET", acceptEncoding, contentType, body)
+}
+
+func serveMethod(t *testing.T, method, acceptEncoding, contentType, body string) *response.Recorder {
+	t.Helper()
+	handler := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := response.GetDefaultHeaders(len(body))
+		h.Override("Content-Type", contentType)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body))
+	}
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	if acceptEncoding != "" {
+		req.Headers.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec, w := response.NewRecorder()
+	Middleware(Options{})(handler)(w, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	page := strings.Repeat("<p>Your request was an absolute banger.</p>\n", 100)
+
+	// Test: gzip body is chunked and decodes back to the original
+	rec := serve(t, "gzip", "text/html", page)
+	assert.Equal(t, "gzip", rec.Headers["content-encoding"])
+	assert.Equal(t, "Accept-Encoding", rec.Headers["vary"])
+	assert.Equal(t, "chunked", rec.Headers["transfer-encoding"])
+	_, ok := rec.Headers.Get("Content-Length")
+	assert.False(t, ok)
+	assert.True(t, rec.Chunked)
+	zr, err := gzip.NewReader(&rec.Body)
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(got))
+
+	// Test: zstd preferred by q-value
+	rec = serve(t, "gzip;q=0.5, zstd", "text/html", page)
+	assert.Equal(t, "zstd", rec.Headers["content-encoding"])
+	zd, err := zstd.NewReader(&rec.Body)
+	require.NoError(t, err)
+	got, err = io.ReadAll(zd)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(got))
+
+	// Test: No Accept-Encoding leaves the body alone but still varies
+	rec = serve(t, "", "text/html", page)
+	_, ok = rec.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	assert.Equal(t, "Accept-Encoding", rec.Headers["vary"])
+	assert.Equal(t, page, rec.Body.String())
+
+	// Test: HEAD gets the same headers as GET and no body
+	get := serve(t, "gzip", "text/html", page)
+	head := serveMethod(t, "HEAD", "gzip", "text/html", page)
+	assert.Equal(t, get.Headers, head.Headers)
+	assert.Equal(t, 0, head.Body.Len())
+	assert.Empty(t, head.Trailers)
+
+	// Test: Tiny bodies are not compressed
+	rec = serve(t, "gzip", "text/html", "<p>hi</p>")
+	_, ok = rec.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	assert.Equal(t, "<p>hi</p>", rec.Body.String())
+
+	// Test: Already compressed types are skipped
+	rec = serve(t, "gzip", "image/png", page)
+	_, ok = rec.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+}
+
+func TestDecodeRequests(t *testing.T) {
+	decode := func(raw string) (*response.Recorder, string) {
+		req, err := request.HeadFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		var got string
+		rec, w := response.NewRecorder()
+		DecodeRequests(1<<20)(func(w *response.Writer, req *request.Request) {
+			got = string(req.Body)
+			w.WriteStatusLine(response.StatusCodeSuccess)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+		})(w, req)
+		return rec, got
+	}
+	var gz strings.Builder
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("hello"))
+	zw.Close()
+
+	// Test: A gzip body reaches the handler decoded
+	rec, got := decode(fmt.Sprintf("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\n\r\n%s", gz.Len(), gz.String()))
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, "hello", got)
+
+	// Test: An unknown coding is a 415 from the ErrorHandler, listing the
+	// codings we do take
+	rec, _ = decode("POST / HTTP/1.1\r\nContent-Encoding: br\r\nContent-Length: 2\r\n\r\nhi")
+	assert.Equal(t, response.StatusCodeUnsupportedMediaType, rec.StatusCode)
+	assert.Contains(t, rec.HeaderLines, response.HeaderLine{Key: "Accept-Encoding", Value: "gzip, deflate, zstd"})
+	assert.Equal(t, "Unsupported Media Type\n", rec.Body.String())
+
+	// Test: A corrupt body is a 400 that doesn't echo the decoder's error
+	rec, _ = decode("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: 2\r\n\r\nhi")
+	assert.Equal(t, response.StatusCodeBadRequest, rec.StatusCode)
+	assert.Equal(t, "Bad Request\n", rec.Body.String())
+
+	// Test: A body cut short gets the parse error's status
+	rec, _ = decode("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: 5\r\n\r\nh")
+	assert.Equal(t, response.StatusCodeBadRequest, rec.StatusCode)
+	assert.Equal(t, "Bad Request: body shorter than Content-Length\n", rec.Body.String())
+}
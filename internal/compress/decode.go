@@ -0,0 +1,33 @@
+package compress
+
+import (
+	"errors"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// DecodeRequests is middleware that decodes compressed request bodies before
+// the handler sees them, answering 415 for codings it doesn't know and 413
+// when a body decodes to more than maxSize bytes. The errors are written by
+// the server's ErrorHandler.
+func DecodeRequests(maxSize int64) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			err := req.DecodeBody(maxSize)
+			switch {
+			case err == nil:
+				next(w, req)
+			case errors.Is(err, request.ErrUnsupportedEncoding):
+				// tell the client which codings it can use instead
+				w.AddHeaderLine("Accept-Encoding", "gzip, deflate, zstd")
+				server.ServeError(w, req, response.StatusCodeUnsupportedMediaType, err)
+			case errors.Is(err, request.ErrDecodedBodyTooLarge):
+				server.ServeError(w, req, response.StatusCodeContentTooLarge, err)
+			default:
+				server.ServeError(w, req, server.ParseErrorStatus(err), err)
+			}
+		}
+	}
+}
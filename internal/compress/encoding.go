@@ -0,0 +1,46 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a compressor that can be pointed at a new destination and
+// reused.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// encoderPool hands out reset encoders for one content coding.
+type encoderPool struct {
+	pool sync.Pool
+}
+
+func (p *encoderPool) get(w io.Writer) encoder {
+	enc := p.pool.Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+func (p *encoderPool) put(enc encoder) {
+	p.pool.Put(enc)
+}
+
+var pools = map[string]*encoderPool{
+	"gzip": {pool: sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}},
+	"deflate": {pool: sync.Pool{New: func() any {
+		// "deflate" in HTTP means zlib-wrapped deflate, not raw deflate
+		return zlib.NewWriter(io.Discard)
+	}}},
+	"zstd": {pool: sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}}},
+}
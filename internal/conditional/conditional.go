@@ -0,0 +1,201 @@
+// Package conditional is middleware that gives buffered responses an ETag
+// and answers conditional and range requests for them.
+package conditional
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+type Options struct {
+	// Weak makes generated ETags weak, for handlers whose output can vary
+	// in ways that don't matter, like whitespace or timestamps.
+	Weak bool
+}
+
+// notModifiedHeaders are the fields a 304 keeps from the 200 it stands for
+// (RFC 9110 section 15.4.5), plus Connection.
+var notModifiedHeaders = []string{
+	"cache-control", "content-location", "date", "etag", "expires", "vary",
+	"last-modified", "connection",
+}
+
+// Middleware buffers GET and HEAD responses, adds an ETag to successful
+// ones that lack one and then evaluates the request's preconditions and
+// Range against it. Other methods pass straight through; their handlers
+// should call Check before acting.
+func Middleware(opts Options) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			method := req.RequestLine.Method
+			if method != "GET" && method != "HEAD" {
+				next(w, req)
+				return
+			}
+			rec, rw := response.NewRecorder()
+			next(rw, req)
+			if err := serve(w, req, rec, opts); err != nil {
+				log.Printf("conditional: error writing response: %v", err)
+			}
+		}
+	}
+}
+
+func serve(w *response.Writer, req *request.Request, rec *response.Recorder, opts Options) error {
+	if rec.StatusCode < 200 || rec.StatusCode > 299 || rec.Headers == nil {
+		// preconditions only apply to responses that would have been 2xx
+		return rec.Replay(w)
+	}
+	// a HEAD handler may have left the body out, and the tag of an empty
+	// body would be wrong
+	complete := req.RequestLine.Method == "GET" || rec.Body.Len() > 0
+	if _, ok := rec.Headers.Get("ETag"); !ok && rec.StatusCode == response.StatusCodeSuccess && complete {
+		rec.Headers.Override("ETag", ETag(rec.Body.Bytes(), opts.Weak))
+	}
+	etag, _ := rec.Headers.Get("ETag")
+	lastModified, _ := rec.Headers.GetTime("Last-Modified")
+	v := Validators{ETag: etag, LastModified: lastModified}
+
+	switch Check(req, v) {
+	case NotModified:
+		return writeNotModified(w, rec)
+	case PreconditionFailed:
+		return writePreconditionFailed(w, rec)
+	}
+
+	if rec.StatusCode == response.StatusCodeSuccess && !rec.Chunked {
+		rec.Headers.Override("Accept-Ranges", "bytes")
+		// Range only applies to GET
+		if rv, ok := req.Headers.Get("Range"); ok && req.RequestLine.Method == "GET" && RangeApplies(req, v) {
+			return writeRange(w, rec, rv)
+		}
+	}
+	return rec.Replay(w)
+}
+
+func writeNotModified(w *response.Writer, rec *response.Recorder) error {
+	if err := rec.ReplayInformational(w); err != nil {
+		return err
+	}
+	if err := w.WriteStatusLine(response.StatusCodeNotModified); err != nil {
+		return err
+	}
+	for _, l := range rec.HeaderLines {
+		if err := w.AddHeaderLine(l.Key, l.Value); err != nil {
+			return err
+		}
+	}
+	h := headers.NewHeaders()
+	for _, k := range notModifiedHeaders {
+		if v, ok := rec.Headers.Get(k); ok {
+			h.Override(k, v)
+		}
+	}
+	return w.WriteHeaders(h)
+}
+
+func writePreconditionFailed(w *response.Writer, rec *response.Recorder) error {
+	if err := rec.ReplayInformational(w); err != nil {
+		return err
+	}
+	body := []byte("Precondition Failed\n")
+	if err := w.WriteStatusLine(response.StatusCodePreconditionFailed); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(response.GetDefaultHeaders(len(body))); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+	return err
+}
+
+// writeRange answers with the single byte range asked for in rangeValue.
+// Multiple or malformed ranges get the whole body, which RFC 9110 allows.
+func writeRange(w *response.Writer, rec *response.Recorder, rangeValue string) error {
+	size := int64(rec.Body.Len())
+	start, end, ok, satisfiable := parseRange(rangeValue, size)
+	if !ok {
+		return rec.Replay(w)
+	}
+	if err := rec.ReplayInformational(w); err != nil {
+		return err
+	}
+	if !satisfiable {
+		if err := w.WriteStatusLine(response.StatusCodeRangeNotSatisfiable); err != nil {
+			return err
+		}
+		h := response.GetDefaultHeaders(0)
+		h.Override("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return w.WriteHeaders(h)
+	}
+
+	part := rec.Body.Bytes()[start : end+1]
+	if err := w.WriteStatusLine(response.StatusCodePartialContent); err != nil {
+		return err
+	}
+	for _, l := range rec.HeaderLines {
+		if err := w.AddHeaderLine(l.Key, l.Value); err != nil {
+			return err
+		}
+	}
+	h := headers.NewHeaders()
+	for k, v := range rec.Headers {
+		h[k] = v
+	}
+	h.Override("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	h.Override("Content-Length", strconv.Itoa(len(part)))
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	if len(part) == 0 {
+		return nil
+	}
+	_, err := w.WriteBody(part)
+	return err
+}
+
+// parseRange parses a Range value holding one byte range. ok is false when
+// the value should be ignored and satisfiable false when it should get 416.
+func parseRange(v string, size int64) (start, end int64, ok, satisfiable bool) {
+	unit, spec, found := strings.Cut(strings.TrimSpace(v), "=")
+	if !found || !strings.EqualFold(unit, "bytes") || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+	if first == "" {
+		// suffix range: the last n bytes
+		n, err := headers.ParseNonNegativeInt(last)
+		if err != nil {
+			return 0, 0, false, false
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		return max(size-n, 0), size - 1, true, true
+	}
+	start, err := headers.ParseNonNegativeInt(first)
+	if err != nil {
+		return 0, 0, false, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = headers.ParseNonNegativeInt(last); err != nil || end < start {
+			return 0, 0, false, false
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
@@ -0,0 +1,212 @@
+package conditional
+
+import (
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = "<p>Your request was an absolute banger.</p>"
+
+var lastModified = time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newRequest(method string, h map[string]string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for k, v := range h {
+		req.Headers.Set(k, v)
+	}
+	return req
+}
+
+func serveWith(t *testing.T, opts Options, etag string, req *request.Request) *response.Recorder {
+	t.Helper()
+	handler := func(w *response.Writer, _ *request.Request) {
+		w.WriteEarlyHints("</style.css>; rel=preload; as=style")
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := response.GetDefaultHeaders(len(page))
+		h.Override("Content-Type", "text/html")
+		h.Override("Last-Modified", headers.FormatHTTPDate(lastModified))
+		if etag != "" {
+			h.Override("ETag", etag)
+		}
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(page))
+	}
+	rec, w := response.NewRecorder()
+	Middleware(opts)(handler)(w, req)
+	return rec
+}
+
+func get(t *testing.T, h map[string]string) *response.Recorder {
+	t.Helper()
+	return serveWith(t, Options{}, "", newRequest("GET", h))
+}
+
+func TestMiddleware(t *testing.T) {
+	tag := ETag([]byte(page), false)
+
+	// Test: Generated strong ETag on a plain GET
+	rec := get(t, nil)
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, tag, rec.Headers["etag"])
+	assert.Equal(t, "bytes", rec.Headers["accept-ranges"])
+	assert.Equal(t, page, rec.Body.String())
+
+	// Test: Weak ETags when asked for
+	rec = serveWith(t, Options{Weak: true}, "", newRequest("GET", nil))
+	assert.Equal(t, "W/"+tag, rec.Headers["etag"])
+
+	// Test: Handler's own ETag is kept
+	rec = serveWith(t, Options{}, `"v1"`, newRequest("GET", nil))
+	assert.Equal(t, `"v1"`, rec.Headers["etag"])
+
+	// Test: If-None-Match match gives 304 with the validators only
+	rec = get(t, map[string]string{"If-None-Match": `"other", ` + tag})
+	assert.Equal(t, response.StatusCodeNotModified, rec.StatusCode)
+	assert.Equal(t, tag, rec.Headers["etag"])
+	_, ok := rec.Headers.Get("Content-Type")
+	assert.False(t, ok)
+	assert.Equal(t, 0, rec.Body.Len())
+
+	// Test: If-None-Match uses weak comparison
+	rec = get(t, map[string]string{"If-None-Match": "W/" + tag})
+	assert.Equal(t, response.StatusCodeNotModified, rec.StatusCode)
+
+	// Test: If-None-Match mismatch serves the page
+	rec = get(t, map[string]string{"If-None-Match": `"other"`})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: If-Modified-Since not older than Last-Modified gives 304
+	rec = get(t, map[string]string{"If-Modified-Since": headers.FormatHTTPDate(lastModified)})
+	assert.Equal(t, response.StatusCodeNotModified, rec.StatusCode)
+	rec = get(t, map[string]string{"If-Modified-Since": headers.FormatHTTPDate(lastModified.Add(-time.Hour))})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	rec = get(t, map[string]string{
+		"If-None-Match":     `"other"`,
+		"If-Modified-Since": headers.FormatHTTPDate(lastModified),
+	})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: If-Match needs a strong match
+	rec = get(t, map[string]string{"If-Match": tag})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	rec = get(t, map[string]string{"If-Match": "W/" + tag})
+	assert.Equal(t, response.StatusCodePreconditionFailed, rec.StatusCode)
+	rec = get(t, map[string]string{"If-Match": "*"})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: If-Unmodified-Since older than Last-Modified fails
+	rec = get(t, map[string]string{"If-Unmodified-Since": headers.FormatHTTPDate(lastModified.Add(-time.Hour))})
+	assert.Equal(t, response.StatusCodePreconditionFailed, rec.StatusCode)
+	rec = get(t, map[string]string{"If-Unmodified-Since": headers.FormatHTTPDate(lastModified)})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	rec = get(t, map[string]string{
+		"If-Match":            tag,
+		"If-Unmodified-Since": headers.FormatHTTPDate(lastModified.Add(-time.Hour)),
+	})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+
+	// Test: Non-2xx responses ignore preconditions
+	notFound := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeNotFound)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+	rec, w := response.NewRecorder()
+	Middleware(Options{})(notFound)(w, newRequest("GET", map[string]string{"If-Match": `"x"`}))
+	assert.Equal(t, response.StatusCodeNotFound, rec.StatusCode)
+	_, ok = rec.Headers.Get("ETag")
+	assert.False(t, ok)
+}
+
+func TestRange(t *testing.T) {
+	tag := ETag([]byte(page), false)
+
+	// Test: Single byte range
+	rec := get(t, map[string]string{"Range": "bytes=3-9"})
+	assert.Equal(t, response.StatusCodePartialContent, rec.StatusCode)
+	assert.Equal(t, page[3:10], rec.Body.String())
+	assert.Equal(t, "7", rec.Headers["content-length"])
+	assert.Equal(t, "bytes 3-9/43", rec.Headers["content-range"])
+
+	// Test: Suffix and open-ended ranges
+	rec = get(t, map[string]string{"Range": "bytes=-4"})
+	assert.Equal(t, page[len(page)-4:], rec.Body.String())
+	rec = get(t, map[string]string{"Range": "bytes=40-"})
+	assert.Equal(t, page[40:], rec.Body.String())
+
+	// Test: Unsatisfiable range
+	rec = get(t, map[string]string{"Range": "bytes=100-"})
+	assert.Equal(t, response.StatusCodeRangeNotSatisfiable, rec.StatusCode)
+	assert.Equal(t, "bytes */43", rec.Headers["content-range"])
+
+	// Test: Multiple ranges get the whole body
+	rec = get(t, map[string]string{"Range": "bytes=0-1,5-6"})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, page, rec.Body.String())
+
+	// Test: If-Range with the current ETag or date honours Range
+	rec = get(t, map[string]string{"Range": "bytes=0-2", "If-Range": tag})
+	assert.Equal(t, response.StatusCodePartialContent, rec.StatusCode)
+	rec = get(t, map[string]string{"Range": "bytes=0-2", "If-Range": headers.FormatHTTPDate(lastModified)})
+	assert.Equal(t, response.StatusCodePartialContent, rec.StatusCode)
+
+	// Test: Stale If-Range gets the whole body
+	rec = get(t, map[string]string{"Range": "bytes=0-2", "If-Range": `"old"`})
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, page, rec.Body.String())
+
+	// Test: Early hints go out ahead of every response the middleware
+	// writes itself
+	for h, status := range map[string]response.StatusCode{
+		"If-None-Match": response.StatusCodeNotModified,
+		"If-Match":      response.StatusCodePreconditionFailed,
+		"Range":         response.StatusCodePartialContent,
+	} {
+		v := map[string]string{"If-None-Match": tag, "If-Match": `"old"`, "Range": "bytes=0-2"}[h]
+		rec = get(t, map[string]string{h: v})
+		assert.Equal(t, status, rec.StatusCode, h)
+		require.Len(t, rec.Informational, 1, h)
+		assert.Equal(t, response.StatusCodeEarlyHints, rec.Informational[0].StatusCode)
+	}
+	rec = get(t, map[string]string{"Range": "bytes=100-"})
+	assert.Len(t, rec.Informational, 1)
+}
+
+func TestCheck(t *testing.T) {
+	v := Validators{ETag: `"v2"`, LastModified: lastModified}
+
+	// Test: Unsafe methods get 412 rather than 304 from If-None-Match
+	req := newRequest("PUT", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, PreconditionFailed, Check(req, v))
+	assert.Equal(t, Proceed, Check(req, Validators{Missing: true}))
+
+	// Test: If-Match on a missing resource fails
+	req = newRequest("DELETE", map[string]string{"If-Match": "*"})
+	assert.Equal(t, PreconditionFailed, Check(req, Validators{Missing: true}))
+	assert.Equal(t, Proceed, Check(req, v))
+
+	// Test: If-Modified-Since is ignored for unsafe methods
+	req = newRequest("POST", map[string]string{"If-Modified-Since": headers.FormatHTTPDate(lastModified)})
+	assert.Equal(t, Proceed, Check(req, v))
+
+	// Test: Malformed dates are ignored
+	req = newRequest("GET", map[string]string{"If-Unmodified-Since": "yesterday"})
+	assert.Equal(t, Proceed, Check(req, v))
+
+	// Test: Weak tags never match strongly
+	require.False(t, strongMatch(`W/"v2"`, `W/"v2"`))
+	require.True(t, weakMatch(`W/"v2"`, `"v2"`))
+}
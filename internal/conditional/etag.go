@@ -0,0 +1,122 @@
+package conditional
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+)
+
+// Result is the outcome of evaluating a request's preconditions.
+type Result int
+
+const (
+	// Proceed means the method should be performed as normal.
+	Proceed Result = iota
+	// NotModified means a GET or HEAD should be answered with 304.
+	NotModified
+	// PreconditionFailed means the request should be answered with 412.
+	PreconditionFailed
+)
+
+// Validators describe the current state of the target resource.
+type Validators struct {
+	// ETag is the entity-tag with its quotes and any W/ prefix, or "" if
+	// there is none.
+	ETag string
+	// LastModified is zero if unknown.
+	LastModified time.Time
+	// Missing is true when the resource has no current representation, so
+	// that "If-Match: *" fails and "If-None-Match: *" passes.
+	Missing bool
+}
+
+// ETag returns an entity-tag derived from body, weak if weak is set.
+func ETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// Check evaluates If-Match, If-Unmodified-Since, If-None-Match and
+// If-Modified-Since in the order given by RFC 9110 section 13.2.2. Handlers
+// for unsafe methods should call it before changing anything; the
+// Middleware does it for GET and HEAD.
+func Check(req *request.Request, v Validators) Result {
+	if im, ok := req.Headers.Get("If-Match"); ok {
+		if !matchList(im, v, strongMatch) {
+			return PreconditionFailed
+		}
+	} else if since, ok := req.Headers.GetTime("If-Unmodified-Since"); ok && !v.LastModified.IsZero() {
+		if v.LastModified.Truncate(time.Second).After(since) {
+			return PreconditionFailed
+		}
+	}
+
+	safe := req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD"
+	if inm, ok := req.Headers.Get("If-None-Match"); ok {
+		if !matchList(inm, v, weakMatch) {
+			return Proceed
+		}
+		if safe {
+			return NotModified
+		}
+		return PreconditionFailed
+	}
+	if !safe || v.LastModified.IsZero() {
+		return Proceed
+	}
+	if since, ok := req.Headers.GetTime("If-Modified-Since"); ok && !v.LastModified.Truncate(time.Second).After(since) {
+		return NotModified
+	}
+	return Proceed
+}
+
+// RangeApplies reports whether a Range header on req should be honoured,
+// which it is unless If-Range names a validator the resource no longer has
+// (RFC 9110 section 13.1.5).
+func RangeApplies(req *request.Request, v Validators) bool {
+	ir, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+	ir = strings.TrimSpace(ir)
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		return strongMatch(ir, v.ETag)
+	}
+	t, err := headers.ParseHTTPDate(ir)
+	return err == nil && !v.LastModified.IsZero() && v.LastModified.Truncate(time.Second).Equal(t)
+}
+
+// matchList reports whether an If-Match or If-None-Match value matches v.
+func matchList(list string, v Validators, match func(a, b string) bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return !v.Missing
+	}
+	if v.ETag == "" {
+		return false
+	}
+	for _, tag := range headers.SplitList(list) {
+		if match(tag, v.ETag) {
+			return true
+		}
+	}
+	return false
+}
+
+// strongMatch is the strong comparison of RFC 9110 section 8.8.3.2: both
+// tags must be strong and identical.
+func strongMatch(a, b string) bool {
+	return !strings.HasPrefix(a, "W/") && !strings.HasPrefix(b, "W/") && a == b
+}
+
+// weakMatch ignores the W/ prefix on either tag.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
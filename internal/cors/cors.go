@@ -0,0 +1,199 @@
+// Package cors is middleware that lets browsers on other origins call the
+// server, answering preflight requests and adding the Access-Control-*
+// fields to actual responses (https://fetch.spec.whatwg.org/#http-cors-protocol).
+package cors
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+type Options struct {
+	// AllowedOrigins lists the origins allowed to make requests, such as
+	// "https://app.example.com". An entry may hold one "*" standing for
+	// any non-empty run of characters, as in "https://*.example.com" or
+	// "http://localhost:*", and a lone "*" allows every origin. The
+	// opaque origin "null" only matches when listed exactly.
+	AllowedOrigins []string
+	// AllowOriginFunc, if set, is asked about origins AllowedOrigins
+	// doesn't match.
+	AllowOriginFunc func(origin string) bool
+	// AllowedMethods lists the methods preflighted requests may use, or
+	// "*" for any. Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders lists the request fields preflighted requests may
+	// send, or "*" for any.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response fields scripts may read beyond the
+	// CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets requests carry cookies and Authorization. The
+	// allowed origin is then always echoed rather than sent as "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer. Zero
+	// leaves it to the browser's default and a negative value asks it not
+	// to cache at all.
+	MaxAge time.Duration
+}
+
+var defaultMethods = []string{"GET", "HEAD", "POST"}
+
+type policy struct {
+	opts      Options
+	anyOrigin bool
+	exact     map[string]bool
+	patterns  [][2]string // prefix, suffix around the "*"
+	anyMethod bool
+	anyHeader bool
+	headers   map[string]bool
+}
+
+func Middleware(opts Options) server.Middleware {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = defaultMethods
+	}
+	p := &policy{opts: opts, exact: map[string]bool{}, headers: map[string]bool{}}
+	for _, o := range opts.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" {
+			p.anyOrigin = true
+		} else if prefix, suffix, ok := strings.Cut(o, "*"); ok {
+			p.patterns = append(p.patterns, [2]string{prefix, suffix})
+		} else {
+			p.exact[o] = true
+		}
+	}
+	p.anyMethod = slices.Contains(opts.AllowedMethods, "*")
+	for _, h := range opts.AllowedHeaders {
+		if h == "*" {
+			p.anyHeader = true
+		}
+		p.headers[strings.ToLower(h)] = true
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			origin, hasOrigin := req.Headers.Get("Origin")
+			_, hasRequestMethod := req.Headers.Get("Access-Control-Request-Method")
+			if req.RequestLine.Method == "OPTIONS" && hasOrigin && hasRequestMethod {
+				p.preflight(w, req, origin)
+				return
+			}
+			allowed := hasOrigin && p.allowOrigin(origin)
+			next(response.NewSinkWriter(&corsSink{Writer: w, p: p, origin: origin, allowed: allowed}), req)
+		}
+	}
+}
+
+// preflight answers an OPTIONS request asking whether the real request may
+// be sent. A refusal is a 204 without any Access-Control-* fields, which
+// the browser reports as a CORS error.
+func (p *policy) preflight(w *response.Writer, req *request.Request, origin string) {
+	h := headers.NewHeaders()
+	h.AddVary("Origin")
+	h.AddVary("Access-Control-Request-Method")
+	h.AddVary("Access-Control-Request-Headers")
+	h.Set("Connection", "close")
+
+	method, _ := req.Headers.Get("Access-Control-Request-Method")
+	requested := req.Headers.GetList("Access-Control-Request-Headers")
+	if p.allowOrigin(origin) && p.allowMethod(method) && p.allowHeaders(requested) {
+		p.addOrigin(h, origin)
+		if p.anyMethod {
+			h.Set("Access-Control-Allow-Methods", method)
+		} else {
+			h.Set("Access-Control-Allow-Methods", strings.Join(p.opts.AllowedMethods, ", "))
+		}
+		if len(requested) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if p.opts.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.opts.MaxAge/time.Second)))
+		} else if p.opts.MaxAge < 0 {
+			h.Set("Access-Control-Max-Age", "0")
+		}
+	}
+	w.WriteStatusLine(response.StatusCodeNoContent)
+	w.WriteHeaders(h)
+}
+
+func (p *policy) allowOrigin(origin string) bool {
+	o := strings.ToLower(origin)
+	if p.exact[o] {
+		return true
+	}
+	if o != "null" {
+		if p.anyOrigin {
+			return true
+		}
+		for _, pat := range p.patterns {
+			if len(o) > len(pat[0])+len(pat[1]) && strings.HasPrefix(o, pat[0]) && strings.HasSuffix(o, pat[1]) {
+				return true
+			}
+		}
+	}
+	return p.opts.AllowOriginFunc != nil && p.opts.AllowOriginFunc(origin)
+}
+
+func (p *policy) allowMethod(method string) bool {
+	return p.anyMethod || slices.Contains(p.opts.AllowedMethods, method)
+}
+
+func (p *policy) allowHeaders(requested []string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, h := range requested {
+		if !p.headers[strings.ToLower(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+// variesByOrigin reports whether responses differ by Origin, so caches
+// must key on it. Only a wildcard answer is the same for everyone.
+func (p *policy) variesByOrigin() bool {
+	return !p.anyOrigin || p.opts.AllowCredentials || p.opts.AllowOriginFunc != nil || len(p.exact) > 0 || len(p.patterns) > 0
+}
+
+func (p *policy) addOrigin(h headers.Headers, origin string) {
+	if p.anyOrigin && !p.opts.AllowCredentials {
+		h.Override("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Override("Access-Control-Allow-Origin", origin)
+	}
+	if p.opts.AllowCredentials {
+		h.Override("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsSink adds the Access-Control-* fields to the handler's headers.
+type corsSink struct {
+	*response.Writer
+	p       *policy
+	origin  string
+	allowed bool
+}
+
+func (c *corsSink) WriteHeaders(h headers.Headers) error {
+	if c.p.variesByOrigin() {
+		// even responses to same-origin requests, so a cache doesn't hand
+		// them to a cross-origin one
+		h.AddVary("Origin")
+	}
+	if c.allowed {
+		c.p.addOrigin(h, c.origin)
+		if len(c.p.opts.ExposedHeaders) > 0 {
+			h.Override("Access-Control-Expose-Headers", strings.Join(c.p.opts.ExposedHeaders, ", "))
+		}
+	}
+	return c.Writer.WriteHeaders(h)
+}
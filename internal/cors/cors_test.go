@@ -0,0 +1,173 @@
+package cors
+
+import (
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func page(w *response.Writer, _ *request.Request) {
+	body := []byte("hello")
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func do(h server.Handler, method string, fields ...string) *response.Recorder {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	rec, w := response.NewRecorder()
+	h(w, req)
+	return rec
+}
+
+func TestActualRequest(t *testing.T) {
+	h := Middleware(Options{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		ExposedHeaders: []string{"X-Request-Id"},
+	})(page)
+
+	// Test: Listed origin is echoed with exposed headers
+	rec := do(h, "GET", "Origin", "https://app.example.com")
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, "https://app.example.com", rec.Headers["access-control-allow-origin"])
+	assert.Equal(t, "X-Request-Id", rec.Headers["access-control-expose-headers"])
+	assert.Equal(t, "Origin", rec.Headers["vary"])
+	assert.NotContains(t, rec.Headers, "access-control-allow-credentials")
+
+	// Test: Origins are compared case-insensitively
+	rec = do(h, "GET", "Origin", "HTTPS://APP.example.com")
+	assert.Equal(t, "HTTPS://APP.example.com", rec.Headers["access-control-allow-origin"])
+
+	// Test: Pattern matches a subdomain but needs something in place of *
+	rec = do(h, "GET", "Origin", "https://a.b.example.org")
+	assert.Equal(t, "https://a.b.example.org", rec.Headers["access-control-allow-origin"])
+	rec = do(h, "GET", "Origin", "https://.example.org")
+	assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+	rec = do(h, "GET", "Origin", "https://example.org")
+	assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+
+	// Test: Unknown origin gets the response without CORS fields but with Vary
+	rec = do(h, "GET", "Origin", "https://evil.example")
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+	assert.NotContains(t, rec.Headers, "access-control-expose-headers")
+	assert.Equal(t, "Origin", rec.Headers["vary"])
+
+	// Test: Same-origin requests still vary by Origin
+	rec = do(h, "GET")
+	assert.Equal(t, "Origin", rec.Headers["vary"])
+
+	// Test: "null" is not matched by patterns
+	rec = do(h, "GET", "Origin", "null")
+	assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+}
+
+func TestWildcardOrigin(t *testing.T) {
+	// Test: Lone * answers * and doesn't vary
+	rec := do(Middleware(Options{AllowedOrigins: []string{"*"}})(page), "GET", "Origin", "https://x.example")
+	assert.Equal(t, "*", rec.Headers["access-control-allow-origin"])
+	assert.NotContains(t, rec.Headers, "vary")
+
+	// Test: * with credentials echoes the origin
+	rec = do(Middleware(Options{AllowedOrigins: []string{"*"}, AllowCredentials: true})(page), "GET", "Origin", "https://x.example")
+	assert.Equal(t, "https://x.example", rec.Headers["access-control-allow-origin"])
+	assert.Equal(t, "true", rec.Headers["access-control-allow-credentials"])
+	assert.Equal(t, "Origin", rec.Headers["vary"])
+
+	// Test: * doesn't allow the opaque origin
+	rec = do(Middleware(Options{AllowedOrigins: []string{"*"}})(page), "GET", "Origin", "null")
+	assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+
+	// Test: AllowOriginFunc is consulted for the rest
+	h := Middleware(Options{AllowOriginFunc: func(o string) bool { return o == "null" }})(page)
+	rec = do(h, "GET", "Origin", "null")
+	assert.Equal(t, "null", rec.Headers["access-control-allow-origin"])
+}
+
+func TestPreflight(t *testing.T) {
+	called := false
+	h := Middleware(Options{
+		AllowedOrigins:   []string{"http://localhost:*"},
+		AllowedMethods:   []string{"GET", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})(func(w *response.Writer, req *request.Request) {
+		called = true
+		page(w, req)
+	})
+
+	// Test: Allowed preflight is answered without calling the handler
+	rec := do(h, "OPTIONS",
+		"Origin", "http://localhost:3000",
+		"Access-Control-Request-Method", "PUT",
+		"Access-Control-Request-Headers", "content-type, authorization")
+	assert.False(t, called)
+	assert.Equal(t, response.StatusCodeNoContent, rec.StatusCode)
+	assert.Equal(t, "http://localhost:3000", rec.Headers["access-control-allow-origin"])
+	assert.Equal(t, "GET, PUT, DELETE", rec.Headers["access-control-allow-methods"])
+	assert.Equal(t, "content-type, authorization", rec.Headers["access-control-allow-headers"])
+	assert.Equal(t, "true", rec.Headers["access-control-allow-credentials"])
+	assert.Equal(t, "600", rec.Headers["access-control-max-age"])
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", rec.Headers["vary"])
+	assert.Equal(t, 0, rec.Body.Len())
+
+	// Test: Disallowed method, header or origin gets no CORS fields
+	for _, fields := range [][]string{
+		{"Origin", "http://localhost:3000", "Access-Control-Request-Method", "PATCH"},
+		{"Origin", "http://localhost:3000", "Access-Control-Request-Method", "GET", "Access-Control-Request-Headers", "x-secret"},
+		{"Origin", "https://localhost:3000", "Access-Control-Request-Method", "GET"},
+	} {
+		rec = do(h, "OPTIONS", fields...)
+		assert.Equal(t, response.StatusCodeNoContent, rec.StatusCode)
+		assert.NotContains(t, rec.Headers, "access-control-allow-origin")
+		assert.NotContains(t, rec.Headers, "access-control-allow-methods")
+		assert.Contains(t, rec.Headers["vary"], "Origin")
+	}
+	assert.False(t, called)
+
+	// Test: OPTIONS without Access-Control-Request-Method goes to the handler
+	rec = do(h, "OPTIONS", "Origin", "http://localhost:3000")
+	assert.True(t, called)
+	assert.Equal(t, "http://localhost:3000", rec.Headers["access-control-allow-origin"])
+
+	// Test: Wildcard methods and headers echo the request, negative MaxAge disables caching
+	h = Middleware(Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"*"},
+		AllowedHeaders: []string{"*"},
+		MaxAge:         -1,
+	})(page)
+	rec = do(h, "OPTIONS",
+		"Origin", "https://x.example",
+		"Access-Control-Request-Method", "PATCH",
+		"Access-Control-Request-Headers", "x-anything")
+	assert.Equal(t, "*", rec.Headers["access-control-allow-origin"])
+	assert.Equal(t, "PATCH", rec.Headers["access-control-allow-methods"])
+	assert.Equal(t, "x-anything", rec.Headers["access-control-allow-headers"])
+	assert.Equal(t, "0", rec.Headers["access-control-max-age"])
+}
+
+func TestExistingVary(t *testing.T) {
+	// Test: Origin is appended to the handler's Vary once
+	h := Middleware(Options{AllowedOrigins: []string{"https://a.example"}})(func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		hs := response.GetDefaultHeaders(0)
+		hs.Set("Vary", "Accept-Encoding, origin")
+		w.WriteHeaders(hs)
+	})
+	rec := do(h, "GET", "Origin", "https://a.example")
+	assert.Equal(t, "Accept-Encoding, origin", rec.Headers["vary"])
+}
@@ -0,0 +1,260 @@
+package headers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AcceptItem is one entry of an Accept, Accept-Language, Accept-Charset or
+// Accept-Encoding header.
+type AcceptItem struct {
+	// Value is the media range, language range, charset or coding,
+	// lowercased.
+	Value string
+	// Params holds any parameters other than q, with lowercased names.
+	Params map[string]string
+	Q      float64
+}
+
+// ParseAccept parses an Accept-style header value (RFC 9110 section 12.5),
+// ordered by descending q-value. Items with equal q keep their order.
+// Malformed q-values are treated as 1.
+func ParseAccept(value string) []AcceptItem {
+	var items []AcceptItem
+	for _, part := range splitQuoted(value, ',') {
+		fields := splitQuoted(part, ';')
+		v := strings.ToLower(strings.TrimSpace(fields[0]))
+		if v == "" {
+			continue
+		}
+		item := AcceptItem{Value: v, Q: 1}
+		for _, param := range fields[1:] {
+			name, arg, _ := strings.Cut(param, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			arg = strings.TrimSpace(arg)
+			if name == "" {
+				continue
+			}
+			if name == "q" {
+				if q, err := strconv.ParseFloat(arg, 64); err == nil && q >= 0 && q <= 1 {
+					item.Q = q
+				}
+				// anything after q is an accept-ext, which we ignore
+				break
+			}
+			if item.Params == nil {
+				item.Params = map[string]string{}
+			}
+			item.Params[name] = unquote(arg)
+		}
+		items = append(items, item)
+	}
+	slices.SortStableFunc(items, func(a, b AcceptItem) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return items
+}
+
+// Negotiate picks the best of offers, which are media types like
+// "text/html" or "application/json", for the Accept header. With no Accept
+// header the first offer wins. The bool is false when nothing offered is
+// acceptable, in which case the caller should answer 406 Not Acceptable.
+func (h Headers) Negotiate(offers ...string) (string, bool) {
+	v, ok := h.Get("Accept")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return negotiate(ParseAccept(v), offers, mediaRangeMatch)
+}
+
+// NegotiateLanguage picks the best of offers, which are language tags, for
+// the Accept-Language header using basic filtering (RFC 4647 section 3.3.1).
+func (h Headers) NegotiateLanguage(offers ...string) (string, bool) {
+	v, ok := h.Get("Accept-Language")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return negotiate(ParseAccept(v), offers, languageMatch)
+}
+
+// NegotiateCharset picks the best of offers for the Accept-Charset header.
+func (h Headers) NegotiateCharset(offers ...string) (string, bool) {
+	v, ok := h.Get("Accept-Charset")
+	if !ok {
+		return firstOffer(offers)
+	}
+	return negotiate(ParseAccept(v), offers, exactMatch)
+}
+
+// NegotiateEncoding picks the best of offers, which are content codings, for
+// the Accept-Encoding header. "identity" is acceptable unless the client
+// rules it out, and is what an absent or empty header gets.
+func (h Headers) NegotiateEncoding(offers ...string) (string, bool) {
+	v, _ := h.Get("Accept-Encoding")
+	items := ParseAccept(v)
+	for i := range items {
+		if items[i].Value == "x-gzip" {
+			items[i].Value = "gzip"
+		}
+	}
+	identityQ, explicit := 1.0, false
+	for _, item := range items {
+		if item.Value == "identity" {
+			identityQ, explicit = item.Q, true
+		}
+	}
+	if !explicit {
+		// identity is implicitly acceptable unless "*;q=0" excludes it
+		// (section 12.5.3)
+		for _, item := range items {
+			if item.Value == "*" && item.Q == 0 {
+				identityQ = 0
+			}
+		}
+	}
+	offers = slices.DeleteFunc(slices.Clone(offers), func(o string) bool { return o == "identity" })
+	best, ok := negotiate(items, offers, exactMatch)
+	if ok && (!explicit || codingQ(items, best) >= identityQ) {
+		return best, true
+	}
+	if identityQ > 0 {
+		return "identity", true
+	}
+	return "", false
+}
+
+// codingQ is the q-value items give coding.
+func codingQ(items []AcceptItem, coding string) float64 {
+	q := 0.0
+	for _, item := range items {
+		if item.Value == coding {
+			return item.Q
+		}
+		if item.Value == "*" {
+			q = item.Q
+		}
+	}
+	return q
+}
+
+func firstOffer(offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	return offers[0], true
+}
+
+// negotiate finds each offer's q-value from the most specific item that
+// matches it and returns the offer with the highest, preferring earlier
+// offers on ties. match returns how specific a match is, or -1 for none.
+func negotiate(items []AcceptItem, offers []string, match func(item AcceptItem, offer string) int) (string, bool) {
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		specificity, q := -1, 0.0
+		for _, item := range items {
+			if s := match(item, strings.ToLower(offer)); s > specificity {
+				specificity, q = s, item.Q
+			}
+		}
+		if specificity >= 0 && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+func mediaRangeMatch(item AcceptItem, offer string) int {
+	offerType, offerParams := splitMediaType(offer)
+	typ, sub, _ := strings.Cut(item.Value, "/")
+	otyp, osub, _ := strings.Cut(offerType, "/")
+	switch {
+	case typ == "*" && sub == "*":
+		return 0
+	case typ != otyp:
+		return -1
+	case sub == "*":
+		return 1
+	case sub != osub:
+		return -1
+	}
+	for k, v := range item.Params {
+		if offerParams[k] != v {
+			return -1
+		}
+	}
+	return 2 + len(item.Params)
+}
+
+func languageMatch(item AcceptItem, offer string) int {
+	if item.Value == "*" {
+		return 0
+	}
+	if offer == item.Value || strings.HasPrefix(offer, item.Value+"-") {
+		return len(item.Value)
+	}
+	return -1
+}
+
+func exactMatch(item AcceptItem, offer string) int {
+	switch item.Value {
+	case "*":
+		return 0
+	case offer:
+		return 1
+	}
+	return -1
+}
+
+// splitMediaType splits "type/subtype; a=b" into the type and its
+// parameters.
+func splitMediaType(v string) (string, map[string]string) {
+	fields := splitQuoted(v, ';')
+	params := map[string]string{}
+	for _, f := range fields[1:] {
+		name, arg, _ := strings.Cut(f, "=")
+		params[strings.ToLower(strings.TrimSpace(name))] = unquote(strings.TrimSpace(arg))
+	}
+	return strings.ToLower(strings.TrimSpace(fields[0])), params
+}
+
+// splitQuoted splits v on sep, ignoring separators inside quoted strings.
+func splitQuoted(v string, sep byte) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			parts = append(parts, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, v[start:])
+}
+
+// unquote removes the quotes and backslash escapes from a quoted-string,
+// returning anything else unchanged.
+func unquote(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+	var b strings.Builder
+	for i := 1; i < len(v)-1; i++ {
+		if v[i] == '\\' && i+1 < len(v)-1 {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package headers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite is the SameSite attribute of a cookie.
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a cookie as sent in a Cookie header (just Name and Value) or set
+// with Set-Cookie (RFC 6265).
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge of 0 means no Max-Age attribute. A negative MaxAge deletes the
+	// cookie straight away and is sent as Max-Age=0.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// ParseCookies parses the value of a Cookie header into name/value pairs.
+// Pairs that aren't valid are skipped, as browsers send all sorts.
+func ParseCookies(value string) []*Cookie {
+	var cookies []*Cookie
+	// Cookie values can't contain ',' so splitting on it undoes the folding
+	// of repeated Cookie headers by Headers.Set.
+	pairs := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' })
+	for _, pair := range pairs {
+		name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		val = strings.TrimSpace(val)
+		if !validCookieName(name) || !validCookieValue(val) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: strings.Trim(val, `"`)})
+	}
+	return cookies
+}
+
+// Valid checks that c can be sent in a Set-Cookie header.
+func (c *Cookie) Valid() error {
+	if !validCookieName(c.Name) {
+		return fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	if !validCookieValue(c.Value) {
+		return fmt.Errorf("invalid cookie value for %s: %q", c.Name, c.Value)
+	}
+	if strings.ContainsFunc(c.Path, func(r rune) bool { return r < 0x20 || r == 0x7f || r == ';' }) {
+		return fmt.Errorf("invalid cookie path: %q", c.Path)
+	}
+	if c.Domain != "" && !validCookieDomain(c.Domain) {
+		return fmt.Errorf("invalid cookie domain: %q", c.Domain)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return fmt.Errorf("cookie %s: SameSite=None requires Secure", c.Name)
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("cookie %s: Partitioned requires Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return fmt.Errorf("cookie %s: __Secure- prefix requires Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Domain != "" || c.Path != "/") {
+		return fmt.Errorf("cookie %s: __Host- prefix requires Secure, Path=/ and no Domain", c.Name)
+	}
+	return nil
+}
+
+// String serializes c as the value of a Set-Cookie header. It doesn't
+// validate; call Valid first.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + FormatHTTPDate(c.Expires))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+func validCookieName(name string) bool {
+	return name != "" && validTokens([]byte(name))
+}
+
+// validCookieValue checks value against cookie-value in RFC 6265 section
+// 4.1.1, which allows it to be wrapped in double quotes.
+func validCookieValue(value string) bool {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func validCookieDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
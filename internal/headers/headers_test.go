@@ -2,6 +2,7 @@ package headers
 
 import (
 	"testing"
+	"time"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,6 +26,14 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
+	// Test: Header line without a colon
+	headers = NewHeaders()
+	data = []byte("Host localhost\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
 	//Test: Header key with capital letters is normalized to lowercase
 	headers = NewHeaders()
 	data = []byte("HoSt: localhost:42069\r\n\r\n")
@@ -53,4 +62,172 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, "localhost:8001, localhost:42069", headers["host"])
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
-}
\ No newline at end of file
+}
+
+func TestCookies(t *testing.T) {
+	// Test: Cookie header is split into pairs
+	cookies := ParseCookies(`session=abc123; theme="dark"; bad pair; =novalue`)
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+
+	// Test: Folded Cookie headers
+	cookies = ParseCookies("a=1, b=2")
+	require.Len(t, cookies, 2)
+	assert.Equal(t, "b", cookies[1].Name)
+
+	// Test: Set-Cookie serialization with all attributes
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Path:        "/",
+		Domain:      "example.com",
+		Expires:     time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "id=a3fWa; Path=/; Domain=example.com; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Deleting a cookie
+	c = &Cookie{Name: "id", MaxAge: -1}
+	assert.Equal(t, "id=; Max-Age=0", c.String())
+
+	// Test: Invalid cookies
+	assert.Error(t, (&Cookie{Name: "bad name", Value: "x"}).Valid())
+	assert.Error(t, (&Cookie{Name: "id", Value: "a;b"}).Valid())
+	assert.Error(t, (&Cookie{Name: "id", Value: "x", SameSite: SameSiteNone}).Valid())
+	assert.Error(t, (&Cookie{Name: "id", Value: "x", Domain: "bad_domain.com"}).Valid())
+	assert.Error(t, (&Cookie{Name: "__Host-id", Value: "x", Secure: true, Path: "/app"}).Valid())
+}
+
+func TestNegotiate(t *testing.T) {
+	// Test: Accept q-values and precedence of specific ranges
+	items := ParseAccept(`text/*;q=0.3, text/html;q=0.7, text/html;level=1, */*;q=0.5`)
+	require.Len(t, items, 4)
+	assert.Equal(t, "text/html", items[0].Value)
+	assert.Equal(t, "1", items[0].Params["level"])
+	assert.Equal(t, 0.3, items[3].Q)
+
+	h := Headers{"accept": "text/html;q=0.8, application/json"}
+	best, ok := h.Negotiate("text/html", "application/json")
+	require.True(t, ok)
+	assert.Equal(t, "application/json", best)
+
+	h = Headers{"accept": "text/*;q=0.3, text/plain;q=0"}
+	best, ok = h.Negotiate("text/plain", "text/html")
+	require.True(t, ok)
+	assert.Equal(t, "text/html", best)
+
+	// Test: Nothing acceptable
+	h = Headers{"accept": "image/png"}
+	_, ok = h.Negotiate("text/html", "application/json")
+	assert.False(t, ok)
+
+	// Test: No Accept header takes the first offer
+	best, ok = NewHeaders().Negotiate("text/html", "application/json")
+	require.True(t, ok)
+	assert.Equal(t, "text/html", best)
+
+	// Test: Language ranges match by prefix
+	h = Headers{"accept-language": "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5"}
+	best, _ = h.NegotiateLanguage("en-US", "fr-FR", "de")
+	assert.Equal(t, "fr-FR", best)
+	best, _ = h.NegotiateLanguage("de", "en-GB")
+	assert.Equal(t, "en-GB", best)
+
+	// Test: Charsets
+	h = Headers{"accept-charset": "iso-8859-5, utf-8;q=0.5"}
+	best, _ = h.NegotiateCharset("utf-8", "iso-8859-5")
+	assert.Equal(t, "iso-8859-5", best)
+
+	// Test: Encodings and identity
+	offers := []string{"zstd", "gzip", "deflate"}
+	enc := func(v string) string {
+		e, ok := Headers{"accept-encoding": v}.NegotiateEncoding(offers...)
+		if !ok {
+			return "406"
+		}
+		return e
+	}
+	assert.Equal(t, "zstd", enc("gzip, deflate, zstd"))
+	assert.Equal(t, "gzip", enc("gzip, deflate"))
+	assert.Equal(t, "deflate", enc("gzip;q=0.2, deflate;q=0.8"))
+	assert.Equal(t, "gzip", enc("*;q=0.1, gzip"))
+	assert.Equal(t, "identity", enc("gzip;q=0, br"))
+	assert.Equal(t, "identity", enc(""))
+	assert.Equal(t, "identity", enc("gzip;q=0.5, identity"))
+	assert.Equal(t, "406", enc("br, *;q=0"))
+}
+
+func TestTypedAccessors(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+
+	// Test: HTTP-date in all three formats
+	for _, v := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseHTTPDate(v)
+		require.NoError(t, err, v)
+		assert.True(t, want.Equal(got), v)
+	}
+	_, err := ParseHTTPDate("yesterday")
+	assert.Error(t, err)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", FormatHTTPDate(want.In(time.FixedZone("X", 3600))))
+
+	h := Headers{"last-modified": "Sun, 06 Nov 1994 08:49:37 GMT", "date": "nope"}
+	got, ok := h.GetTime("Last-Modified")
+	require.True(t, ok)
+	assert.True(t, want.Equal(got))
+	_, ok = h.GetTime("Date")
+	assert.False(t, ok)
+
+	// Test: Strict non-negative integers
+	n, err := ParseNonNegativeInt("1234")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), n)
+	for _, v := range []string{"", "+5", "-1", " 5", "5, 5", "0x10", "99999999999999999999"} {
+		_, err := ParseNonNegativeInt(v)
+		assert.Error(t, err, v)
+	}
+	h = Headers{"content-length": "42", "age": "-3"}
+	n, ok, err = h.GetInt("Content-Length")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), n)
+	_, ok, err = h.GetInt("Age")
+	assert.True(t, ok)
+	assert.Error(t, err)
+	_, ok, _ = h.GetInt("Max-Forwards")
+	assert.False(t, ok)
+
+	// Test: Media types with parameters
+	mt, params, err := ParseMediaType(`Text/HTML; Charset="utf-8"; foo=bar`)
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", mt)
+	assert.Equal(t, map[string]string{"charset": "utf-8", "foo": "bar"}, params)
+	mt, params, err = ParseMediaType(`multipart/form-data; boundary="a;b"`)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mt)
+	assert.Equal(t, "a;b", params["boundary"])
+	for _, v := range []string{"", "text", "text/", "text/html; charset", `text/html; a="b`, "text/html; a=1; a=2"} {
+		_, _, err := ParseMediaType(v)
+		assert.Error(t, err, v)
+	}
+	_, _, err = NewHeaders().GetMediaType()
+	assert.Error(t, err)
+
+	// Test: List splitting respects quoted strings
+	assert.Equal(t, []string{"no-cache", `private="a, b"`, "max-age=5"}, SplitList(` no-cache,, private="a, b" ,max-age=5,`))
+	assert.Nil(t, SplitList(" , "))
+	h = Headers{"vary": "Accept, Accept-Encoding"}
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, h.GetList("Vary"))
+	assert.Nil(t, h.GetList("Allow"))
+}
@@ -0,0 +1,403 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalid is wrapped by every parse and serialization error.
+var ErrInvalid = errors.New("invalid structured field")
+
+// ParseItem parses an Item field value. Repeated fields joined by
+// Headers.Set aren't valid Items.
+func ParseItem(v string) (Item, error) {
+	p := parser{s: v}
+	p.skipSP()
+	item, err := p.item()
+	if err != nil {
+		return Item{}, err
+	}
+	p.skipSP()
+	if !p.eof() {
+		return Item{}, p.errorf("unexpected %q after item", p.peek())
+	}
+	return item, nil
+}
+
+// ParseList parses a List field value.
+func ParseList(v string) (List, error) {
+	p := parser{s: v}
+	p.skipSP()
+	var list List
+	for !p.eof() {
+		m, err := p.member()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+		if err := p.separator(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// ParseDictionary parses a Dictionary field value. A repeated key keeps its
+// first position but takes its last value.
+func ParseDictionary(v string) (Dictionary, error) {
+	p := parser{s: v}
+	p.skipSP()
+	var dict Dictionary
+	for !p.eof() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var m Member
+		if p.consume('=') {
+			m, err = p.member()
+		} else {
+			var params Params
+			params, err = p.params()
+			m = Item{Value: true, Params: params}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dict.set(key, m)
+		if err := p.separator(); err != nil {
+			return nil, err
+		}
+	}
+	return dict, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) consume(c byte) bool {
+	if !p.eof() && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSP() {
+	for p.consume(' ') {
+	}
+}
+
+func (p *parser) skipOWS() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrInvalid, p.pos, fmt.Sprintf(format, args...))
+}
+
+// separator consumes the comma between List or Dictionary members.
+func (p *parser) separator() error {
+	p.skipOWS()
+	if p.eof() {
+		return nil
+	}
+	if !p.consume(',') {
+		return p.errorf("expected ',' but got %q", p.peek())
+	}
+	p.skipOWS()
+	if p.eof() {
+		return p.errorf("trailing comma")
+	}
+	return nil
+}
+
+func (p *parser) member() (Member, error) {
+	if p.peek() == '(' {
+		return p.innerList()
+	}
+	return p.item()
+}
+
+func (p *parser) innerList() (InnerList, error) {
+	p.pos++ // (
+	var items []Item
+	for !p.eof() {
+		p.skipSP()
+		if p.consume(')') {
+			params, err := p.params()
+			if err != nil {
+				return InnerList{}, err
+			}
+			return InnerList{Items: items, Params: params}, nil
+		}
+		item, err := p.item()
+		if err != nil {
+			return InnerList{}, err
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return InnerList{}, p.errorf("expected ' ' or ')' in inner list but got %q", c)
+		}
+	}
+	return InnerList{}, p.errorf("unterminated inner list")
+}
+
+func (p *parser) item() (Item, error) {
+	v, err := p.bareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.params()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: v, Params: params}, nil
+}
+
+func (p *parser) params() (Params, error) {
+	var params Params
+	for p.consume(';') {
+		p.skipSP()
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var v any = true
+		if p.consume('=') {
+			if v, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params.set(key, v)
+	}
+	return params, nil
+}
+
+func (p *parser) key() (string, error) {
+	start := p.pos
+	if c := p.peek(); !isLCAlpha(c) && c != '*' {
+		return "", p.errorf("invalid key start %q", c)
+	}
+	for !p.eof() && isKeyChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *parser) bareItem() (any, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.str()
+	case isAlpha(c) || c == '*':
+		return p.token(), nil
+	case c == ':':
+		return p.byteSequence()
+	case c == '?':
+		return p.boolean()
+	case c == '@':
+		return p.date()
+	case c == '%':
+		return p.displayString()
+	default:
+		if p.eof() {
+			return nil, p.errorf("missing item")
+		}
+		return nil, p.errorf("unexpected %q at start of item", c)
+	}
+}
+
+// number parses an Integer (int64) or Decimal (float64).
+func (p *parser) number() (any, error) {
+	start := p.pos
+	neg := p.consume('-')
+	if !isDigit(p.peek()) {
+		return nil, p.errorf("expected digit")
+	}
+	digitsStart := p.pos
+	dot := -1
+	for !p.eof() {
+		c := p.s[p.pos]
+		if c == '.' && dot < 0 {
+			if p.pos-digitsStart > 12 {
+				return nil, p.errorf("decimal has too many integer digits")
+			}
+			dot = p.pos
+		} else if !isDigit(c) {
+			break
+		}
+		p.pos++
+		n := p.pos - digitsStart
+		if dot < 0 && n > 15 {
+			return nil, p.errorf("integer has too many digits")
+		}
+		if dot >= 0 && n > 16 {
+			return nil, p.errorf("decimal has too many digits")
+		}
+	}
+	if dot < 0 {
+		n, err := strconv.ParseInt(p.s[start:p.pos], 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer: %s", err)
+		}
+		return n, nil
+	}
+	if frac := p.pos - dot - 1; frac == 0 || frac > 3 {
+		return nil, p.errorf("decimal must have 1 to 3 fractional digits")
+	}
+	f, err := strconv.ParseFloat(p.s[digitsStart:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("invalid decimal: %s", err)
+	}
+	if neg {
+		f = -f
+	}
+	return f, nil
+}
+
+func (p *parser) str() (string, error) {
+	p.pos++ // "
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			next := p.peek()
+			if next != '"' && next != '\\' {
+				return "", p.errorf("invalid escape in string")
+			}
+			b.WriteByte(next)
+			p.pos++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid character %q in string", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) token() Token {
+	start := p.pos
+	p.pos++
+	for !p.eof() && isTokenChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return Token(p.s[start:p.pos])
+}
+
+func (p *parser) byteSequence() ([]byte, error) {
+	p.pos++ // :
+	end := strings.IndexByte(p.s[p.pos:], ':')
+	if end < 0 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	enc := p.s[p.pos : p.pos+end]
+	for i := 0; i < len(enc); i++ {
+		if c := enc[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+			return nil, p.errorf("invalid character %q in byte sequence", c)
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, p.errorf("invalid byte sequence: %s", err)
+	}
+	p.pos += end + 1
+	return b, nil
+}
+
+func (p *parser) boolean() (bool, error) {
+	p.pos++ // ?
+	switch {
+	case p.consume('1'):
+		return true, nil
+	case p.consume('0'):
+		return false, nil
+	}
+	return false, p.errorf("invalid boolean")
+}
+
+func (p *parser) date() (any, error) {
+	p.pos++ // @
+	v, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	sec, ok := v.(int64)
+	if !ok {
+		return nil, p.errorf("date must be an integer")
+	}
+	return date(sec), nil
+}
+
+func (p *parser) displayString() (DisplayString, error) {
+	p.pos++ // %
+	if !p.consume('"') {
+		return "", p.errorf("expected '\"' after '%%'")
+	}
+	var b []byte
+	for !p.eof() {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid character %q in display string", c)
+		case c == '%':
+			if p.pos+2 > len(p.s) || !isLCHex(p.s[p.pos]) || !isLCHex(p.s[p.pos+1]) {
+				return "", p.errorf("invalid percent-encoding in display string")
+			}
+			n, _ := strconv.ParseUint(p.s[p.pos:p.pos+2], 16, 8)
+			b = append(b, byte(n))
+			p.pos += 2
+		case c == '"':
+			if !utf8.Valid(b) {
+				return "", p.errorf("display string is not valid UTF-8")
+			}
+			return DisplayString(b), nil
+		default:
+			b = append(b, c)
+		}
+	}
+	return "", p.errorf("unterminated display string")
+}
+
+func isDigit(c byte) bool   { return c >= '0' && c <= '9' }
+func isLCAlpha(c byte) bool { return c >= 'a' && c <= 'z' }
+func isAlpha(c byte) bool   { return isLCAlpha(c) || c >= 'A' && c <= 'Z' }
+func isLCHex(c byte) bool   { return isDigit(c) || c >= 'a' && c <= 'f' }
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isTokenChar reports whether c is a tchar, ':' or '/'.
+func isTokenChar(c byte) bool {
+	if isAlpha(c) || isDigit(c) {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~:/", c) >= 0
+}
@@ -0,0 +1,238 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxInteger = 999_999_999_999_999
+
+// MarshalItem serializes an Item field value.
+func MarshalItem(item Item) (string, error) {
+	var b strings.Builder
+	if err := writeItem(&b, item); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// MarshalList serializes a List field value. An empty List serializes to ""
+// and the field should then be left out.
+func MarshalList(list List) (string, error) {
+	var b strings.Builder
+	for i, m := range list {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeMember(&b, m); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// MarshalDictionary serializes a Dictionary field value. An empty Dictionary
+// serializes to "" and the field should then be left out.
+func MarshalDictionary(dict Dictionary) (string, error) {
+	var b strings.Builder
+	for i, m := range dict {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeKey(&b, m.Key); err != nil {
+			return "", err
+		}
+		// a true Boolean is written as just the key
+		if item, ok := m.Value.(Item); ok && item.Value == true {
+			if err := writeParams(&b, item.Params); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeMember(&b, m.Value); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func writeMember(b *strings.Builder, m Member) error {
+	switch m := m.(type) {
+	case Item:
+		return writeItem(b, m)
+	case InnerList:
+		b.WriteByte('(')
+		for i, item := range m.Items {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if err := writeItem(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+		return writeParams(b, m.Params)
+	}
+	return fmt.Errorf("%w: unknown member type %T", ErrInvalid, m)
+}
+
+func writeItem(b *strings.Builder, item Item) error {
+	if err := writeBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return writeParams(b, item.Params)
+}
+
+func writeParams(b *strings.Builder, params Params) error {
+	for _, p := range params {
+		b.WriteByte(';')
+		if err := writeKey(b, p.Key); err != nil {
+			return err
+		}
+		if p.Value == true {
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeBareItem(b, p.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(b *strings.Builder, key string) error {
+	if key == "" || !isLCAlpha(key[0]) && key[0] != '*' {
+		return fmt.Errorf("%w: invalid key %q", ErrInvalid, key)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("%w: invalid key %q", ErrInvalid, key)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+func writeBareItem(b *strings.Builder, v any) error {
+	switch v := v.(type) {
+	case int64:
+		return writeInteger(b, v)
+	case int:
+		return writeInteger(b, int64(v))
+	case float64:
+		return writeDecimal(b, v)
+	case string:
+		return writeString(b, v)
+	case Token:
+		return writeToken(b, v)
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+	case time.Time:
+		b.WriteByte('@')
+		return writeInteger(b, v.Unix())
+	case DisplayString:
+		return writeDisplayString(b, v)
+	default:
+		return fmt.Errorf("%w: unsupported bare item type %T", ErrInvalid, v)
+	}
+	return nil
+}
+
+func writeInteger(b *strings.Builder, n int64) error {
+	if n > maxInteger || n < -maxInteger {
+		return fmt.Errorf("%w: integer %d out of range", ErrInvalid, n)
+	}
+	b.WriteString(strconv.FormatInt(n, 10))
+	return nil
+}
+
+// writeDecimal rounds f to three fractional digits, ties to even. The
+// rounding works on f's shortest decimal form so that 0.0025 is a tie.
+func writeDecimal(b *strings.Builder, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("%w: decimal %v out of range", ErrInvalid, f)
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', -1, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 3 && len(intPart) <= 12 {
+		rest := frac[3:]
+		frac = frac[:3]
+		n, _ := strconv.ParseInt(intPart+frac, 10, 64)
+		if rest[0] > '5' || rest[0] == '5' && (strings.TrimRight(rest[1:], "0") != "" || n%2 == 1) {
+			n++
+		}
+		s = fmt.Sprintf("%04d", n)
+		intPart, frac = s[:len(s)-3], s[len(s)-3:]
+	}
+	if len(intPart) > 12 {
+		return fmt.Errorf("%w: decimal %v out of range", ErrInvalid, f)
+	}
+	if frac = strings.TrimRight(frac, "0"); frac == "" {
+		frac = "0"
+	}
+	if f < 0 && (intPart != "0" || frac != "0") {
+		b.WriteByte('-')
+	}
+	b.WriteString(intPart + "." + frac)
+	return nil
+}
+
+func writeString(b *strings.Builder, s string) error {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("%w: invalid character %q in string", ErrInvalid, c)
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return nil
+}
+
+func writeToken(b *strings.Builder, t Token) error {
+	if t == "" || !isAlpha(t[0]) && t[0] != '*' {
+		return fmt.Errorf("%w: invalid token %q", ErrInvalid, t)
+	}
+	for i := 1; i < len(t); i++ {
+		if !isTokenChar(t[i]) {
+			return fmt.Errorf("%w: invalid token %q", ErrInvalid, t)
+		}
+	}
+	b.WriteString(string(t))
+	return nil
+}
+
+func writeDisplayString(b *strings.Builder, s DisplayString) error {
+	if !utf8.ValidString(string(s)) {
+		return fmt.Errorf("%w: display string is not valid UTF-8", ErrInvalid)
+	}
+	b.WriteString(`%"`)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' || c == '"' || c < 0x20 || c > 0x7e {
+			fmt.Fprintf(b, "%%%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return nil
+}
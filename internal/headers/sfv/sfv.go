@@ -0,0 +1,112 @@
+// Package sfv parses and serializes Structured Field Values (RFC 9651, which
+// obsoletes RFC 8941), the format of fields like Priority, Cache-Status and
+// Signature-Input.
+//
+// Bare item values are represented by Go types:
+//
+//	Integer        int64
+//	Decimal        float64
+//	String         string
+//	Token          Token
+//	Byte Sequence  []byte
+//	Boolean        bool
+//	Date           time.Time
+//	Display String DisplayString
+package sfv
+
+import "time"
+
+// Token is a bare item written without quotes, like a media type or *.
+type Token string
+
+// DisplayString is a bare item that may hold any Unicode text. It is
+// percent-encoded on the wire.
+type DisplayString string
+
+// Param is one parameter of an Item or InnerList.
+type Param struct {
+	Key   string
+	Value any
+}
+
+// Params are the parameters of an Item or InnerList, in order.
+type Params []Param
+
+// Get returns the value of the parameter named key.
+func (p Params) Get(key string) (any, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set adds key, or replaces its value in place if it's already there.
+func (p *Params) set(key string, value any) {
+	for i := range *p {
+		if (*p)[i].Key == key {
+			(*p)[i].Value = value
+			return
+		}
+	}
+	*p = append(*p, Param{Key: key, Value: value})
+}
+
+// Member is an Item or an InnerList, the things Lists and Dictionaries hold.
+type Member interface {
+	member()
+}
+
+// Item is a bare item with parameters.
+type Item struct {
+	Value  any
+	Params Params
+}
+
+// InnerList is a parenthesized list of items with parameters of its own.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+func (Item) member()      {}
+func (InnerList) member() {}
+
+// List is a List field value.
+type List []Member
+
+// DictMember is one key and value of a Dictionary.
+type DictMember struct {
+	Key   string
+	Value Member
+}
+
+// Dictionary is a Dictionary field value, in order.
+type Dictionary []DictMember
+
+// Get returns the member named key.
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Dictionary) set(key string, value Member) {
+	for i := range *d {
+		if (*d)[i].Key == key {
+			(*d)[i].Value = value
+			return
+		}
+	}
+	*d = append(*d, DictMember{Key: key, Value: value})
+}
+
+// date values are whole seconds, so keep them in UTC without a monotonic
+// reading to make them comparable.
+func date(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}
@@ -0,0 +1,269 @@
+package sfv
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCase is one vector in the JSON format of the httpwg
+// structured-field-tests suite. testdata/update.sh vendors the suite's
+// files unchanged.
+type testCase struct {
+	Name       string          `json:"name"`
+	Raw        []string        `json:"raw"`
+	HeaderType string          `json:"header_type"`
+	Expected   json.RawMessage `json:"expected"`
+	MustFail   bool            `json:"must_fail"`
+	CanFail    bool            `json:"can_fail"`
+	Canonical  []string        `json:"canonical"`
+}
+
+func loadCases(t *testing.T, pattern string) map[string][]testCase {
+	files, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	cases := map[string][]testCase{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		require.NoError(t, err)
+		var tcs []testCase
+		require.NoError(t, json.Unmarshal(data, &tcs), f)
+		cases[filepath.Base(f)] = tcs
+	}
+	return cases
+}
+
+func parse(headerType, v string) (any, error) {
+	switch headerType {
+	case "item":
+		return ParseItem(v)
+	case "list":
+		return ParseList(v)
+	case "dictionary":
+		return ParseDictionary(v)
+	}
+	panic("unknown header_type " + headerType)
+}
+
+func marshal(headerType string, v any) (string, error) {
+	switch headerType {
+	case "item":
+		return MarshalItem(v.(Item))
+	case "list":
+		return MarshalList(v.(List))
+	case "dictionary":
+		return MarshalDictionary(v.(Dictionary))
+	}
+	panic("unknown header_type " + headerType)
+}
+
+func TestParseVectors(t *testing.T) {
+	for file, tcs := range loadCases(t, "testdata/*.json") {
+		for _, tc := range tcs {
+			t.Run(file+"/"+tc.Name, func(t *testing.T) {
+				// repeated fields are joined the way Headers.Set does
+				got, err := parse(tc.HeaderType, strings.Join(tc.Raw, ", "))
+				if tc.MustFail {
+					require.Error(t, err)
+					return
+				}
+				if tc.CanFail && err != nil {
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, fromJSON(t, tc.HeaderType, tc.Expected), got)
+
+				want := tc.Raw
+				if tc.Canonical != nil {
+					want = tc.Canonical
+				}
+				s, err := marshal(tc.HeaderType, got)
+				require.NoError(t, err)
+				assert.Equal(t, strings.Join(want, ", "), s)
+			})
+		}
+	}
+}
+
+func TestSerializeVectors(t *testing.T) {
+	for file, tcs := range loadCases(t, "testdata/serialisation-tests/*.json") {
+		for _, tc := range tcs {
+			t.Run(file+"/"+tc.Name, func(t *testing.T) {
+				s, err := marshal(tc.HeaderType, fromJSON(t, tc.HeaderType, tc.Expected))
+				if tc.MustFail {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, strings.Join(tc.Canonical, ", "), s)
+			})
+		}
+	}
+}
+
+// TestEveryByte checks every ASCII byte in tokens, strings and keys, on
+// top of the suite's generated vectors.
+func TestEveryByte(t *testing.T) {
+	for i := 0; i < 0x80; i++ {
+		c := byte(i)
+
+		// Test: Tokens take tchar, ':' and '/' after the first character
+		tok := Token("a" + string(c) + "a")
+		s, err := MarshalItem(Item{Value: tok})
+		if isTokenChar(c) {
+			require.NoError(t, err, "%q", c)
+			item, err := ParseItem(s)
+			require.NoError(t, err)
+			assert.Equal(t, tok, item.Value)
+		} else {
+			assert.Error(t, err, "%q", c)
+		}
+		_, err = MarshalItem(Item{Value: Token(string(c))})
+		assert.Equal(t, isAlpha(c) || c == '*', err == nil, "%q", c)
+
+		// Test: Strings take printable ASCII, escaping '"' and '\'
+		str := "a" + string(c) + "a"
+		s, err = MarshalItem(Item{Value: str})
+		if c >= 0x20 && c <= 0x7e {
+			require.NoError(t, err, "%q", c)
+			item, err := ParseItem(s)
+			require.NoError(t, err)
+			assert.Equal(t, str, item.Value)
+		} else {
+			assert.Error(t, err, "%q", c)
+		}
+
+		// Test: Keys are lowercase alphanumerics and _-.*
+		key := "a" + string(c) + "a"
+		s, err = MarshalDictionary(Dictionary{{Key: key, Value: Item{Value: int64(1)}}})
+		if isKeyChar(c) {
+			require.NoError(t, err, "%q", c)
+			dict, err := ParseDictionary(s)
+			require.NoError(t, err)
+			_, ok := dict.Get(key)
+			assert.True(t, ok)
+		} else {
+			assert.Error(t, err, "%q", c)
+		}
+
+		// Test: Display strings round trip any byte of valid UTF-8
+		ds := DisplayString("a" + string(rune(c)) + "ü")
+		s, err = MarshalItem(Item{Value: ds})
+		require.NoError(t, err)
+		item, err := ParseItem(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, ds, item.Value)
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	// Test: Lookups on Params and Dictionary
+	dict, err := ParseDictionary(`u=1, i, x;a=?0;b="c"`)
+	require.NoError(t, err)
+	m, ok := dict.Get("x")
+	require.True(t, ok)
+	v, ok := m.(Item).Params.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, "c", v)
+	_, ok = m.(Item).Params.Get("z")
+	assert.False(t, ok)
+	_, ok = dict.Get("z")
+	assert.False(t, ok)
+
+	// Test: Errors wrap ErrInvalid
+	_, err = ParseList("a,")
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = MarshalItem(Item{Value: 1.5i})
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+// fromJSON converts a vector's expected value into this package's types.
+func fromJSON(t *testing.T, headerType string, raw json.RawMessage) any {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	require.NoError(t, dec.Decode(&v))
+	switch headerType {
+	case "item":
+		return jsonItem(t, v)
+	case "list":
+		var list List
+		for _, m := range v.([]any) {
+			list = append(list, jsonMember(t, m))
+		}
+		return list
+	default:
+		var dict Dictionary
+		for _, kv := range v.([]any) {
+			kv := kv.([]any)
+			dict = append(dict, DictMember{Key: kv[0].(string), Value: jsonMember(t, kv[1])})
+		}
+		return dict
+	}
+}
+
+func jsonMember(t *testing.T, v any) Member {
+	pair := v.([]any)
+	inner, ok := pair[0].([]any)
+	if !ok {
+		return jsonItem(t, v)
+	}
+	il := InnerList{Params: jsonParams(t, pair[1])}
+	for _, item := range inner {
+		il.Items = append(il.Items, jsonItem(t, item))
+	}
+	return il
+}
+
+func jsonItem(t *testing.T, v any) Item {
+	pair := v.([]any)
+	return Item{Value: jsonBareItem(t, pair[0]), Params: jsonParams(t, pair[1])}
+}
+
+func jsonParams(t *testing.T, v any) Params {
+	var params Params
+	for _, kv := range v.([]any) {
+		kv := kv.([]any)
+		params = append(params, Param{Key: kv[0].(string), Value: jsonBareItem(t, kv[1])})
+	}
+	return params
+}
+
+func jsonBareItem(t *testing.T, v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			f, err := v.Float64()
+			require.NoError(t, err)
+			return f
+		}
+		n, err := v.Int64()
+		require.NoError(t, err)
+		return n
+	case map[string]any:
+		switch v["__type"] {
+		case "token":
+			return Token(v["value"].(string))
+		case "binary":
+			b, err := base32.StdEncoding.DecodeString(v["value"].(string))
+			require.NoError(t, err)
+			return b
+		case "date":
+			n, err := v["value"].(json.Number).Int64()
+			require.NoError(t, err)
+			return date(n)
+		case "displaystring":
+			return DisplayString(v["value"].(string))
+		}
+		t.Fatalf("unknown __type %v", v["__type"])
+	}
+	return v
+}
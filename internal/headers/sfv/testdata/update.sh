@@ -0,0 +1,16 @@
+#!/bin/sh
+# Replaces the vectors in this directory with those of the httpwg
+# structured-field-tests suite, unchanged, including the *-generated
+# files, and records the commit they came from in VERSION.
+#
+#	./update.sh [ref]
+set -eu
+cd "$(dirname "$0")"
+ref=${1:-main}
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+git clone --quiet --depth 1 --branch "$ref" https://github.com/httpwg/structured-field-tests.git "$tmp/sft"
+rm -f ./*.json serialisation-tests/*.json
+cp "$tmp"/sft/*.json .
+cp "$tmp"/sft/serialisation-tests/*.json serialisation-tests/
+git -C "$tmp/sft" rev-parse HEAD >VERSION
@@ -0,0 +1,172 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeFormat is IMF-fixdate, the preferred HTTP-date format.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// obsolete HTTP-date formats recipients still have to accept (RFC 9110
+// section 5.6.7)
+const (
+	rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+// ParseHTTPDate parses an HTTP-date in IMF-fixdate, RFC 850 or asctime
+// format. The result is in UTC.
+func ParseHTTPDate(v string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, rfc850Format, asctimeFormat} {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if layout == rfc850Format && t.After(time.Now().AddDate(50, 0, 0)) {
+			// two-digit years more than 50 years ahead mean the past
+			t = t.AddDate(-100, 0, 0)
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP-date: %q", v)
+}
+
+// FormatHTTPDate formats t as an IMF-fixdate.
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// GetTime returns the value of an HTTP-date field such as Date or
+// Last-Modified. The bool is false if the field is missing or malformed.
+func (h Headers) GetTime(key string) (time.Time, bool) {
+	v, ok := h.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := ParseHTTPDate(v)
+	return t, err == nil
+}
+
+// ParseNonNegativeInt parses 1*DIGIT strictly: no sign, whitespace or list
+// of values, as required for fields like Content-Length and Age.
+func ParseNonNegativeInt(v string) (int64, error) {
+	if v == "" {
+		return 0, errors.New("empty integer")
+	}
+	var n int64
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid integer: %q", v)
+		}
+		if n > (1<<63-1-int64(c-'0'))/10 {
+			return 0, fmt.Errorf("integer too large: %q", v)
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n, nil
+}
+
+// GetInt returns the value of a non-negative integer field.
+func (h Headers) GetInt(key string) (int64, bool, error) {
+	v, ok := h.Get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := ParseNonNegativeInt(v)
+	if err != nil {
+		return 0, true, err
+	}
+	return n, true, nil
+}
+
+// ParseMediaType parses a media type such as "text/html; charset=utf-8".
+// The type and parameter names are lowercased; parameter values are
+// unquoted but otherwise left alone.
+func ParseMediaType(v string) (string, map[string]string, error) {
+	fields := splitQuoted(v, ';')
+	mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+	typ, sub, ok := strings.Cut(mediaType, "/")
+	if !ok || !isToken(typ) || !isToken(sub) {
+		return "", nil, fmt.Errorf("invalid media type: %q", v)
+	}
+	params := map[string]string{}
+	for _, f := range fields[1:] {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(f, "=")
+		name = strings.ToLower(name)
+		if !ok || !isToken(name) {
+			return "", nil, fmt.Errorf("invalid media type parameter: %q", f)
+		}
+		if strings.HasPrefix(value, `"`) {
+			if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+				return "", nil, fmt.Errorf("unterminated quoted string: %q", f)
+			}
+			value = unquote(value)
+		} else if !isToken(value) {
+			return "", nil, fmt.Errorf("invalid media type parameter: %q", f)
+		}
+		if _, dup := params[name]; dup {
+			return "", nil, fmt.Errorf("duplicate media type parameter: %q", name)
+		}
+		params[name] = value
+	}
+	return mediaType, params, nil
+}
+
+// GetMediaType parses the Content-Type field.
+func (h Headers) GetMediaType() (string, map[string]string, error) {
+	v, ok := h.Get("Content-Type")
+	if !ok {
+		return "", nil, errors.New("missing Content-Type")
+	}
+	return ParseMediaType(v)
+}
+
+// SplitList splits a comma-separated list field into its elements, trimming
+// whitespace, dropping empty elements and leaving commas inside quoted
+// strings alone.
+func SplitList(v string) []string {
+	var elems []string
+	for _, e := range splitQuoted(v, ',') {
+		if e = strings.TrimSpace(e); e != "" {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// GetList returns the elements of a list field, such as Cache-Control or
+// Vary. Repeated fields were already joined by Set.
+func (h Headers) GetList(key string) []string {
+	v, ok := h.Get(key)
+	if !ok {
+		return nil
+	}
+	return SplitList(v)
+}
+
+// AddVary adds name to the Vary field unless it, or "*", is already there.
+func (h Headers) AddVary(name string) {
+	v, ok := h.Get("Vary")
+	if !ok {
+		h.Override("Vary", name)
+		return
+	}
+	for _, existing := range SplitList(v) {
+		if existing == "*" || strings.EqualFold(existing, name) {
+			return
+		}
+	}
+	h.Override("Vary", v+", "+name)
+}
+
+func isToken(s string) bool {
+	return s != "" && validTokens([]byte(s))
+}
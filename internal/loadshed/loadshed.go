@@ -0,0 +1,102 @@
+// Package loadshed is middleware that turns requests away with 503 Service
+// Unavailable while the server is overloaded, so the requests it does take
+// still finish in good time. The 503s are written by the server's
+// ErrorHandler.
+package loadshed
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// ErrOverloaded is the error the server's ErrorHandler gets for requests
+// that are shed.
+var ErrOverloaded = errors.New("loadshed: server overloaded")
+
+// smoothing is the weight each handler's latency gets in the moving
+// average.
+const smoothing = 0.1
+
+// maxShedFraction is the largest share of requests shed for latency. The
+// rest keep the average up to date, so shedding stops once it recovers.
+const maxShedFraction = 0.9
+
+type Options struct {
+	// MaxInFlight sheds requests that arrive while this many are being
+	// handled. Zero means no limit.
+	MaxInFlight int
+	// MaxLatency sheds a share of requests while the moving average of
+	// handler latency is above it, growing with how far above it is. Zero
+	// means no limit.
+	MaxLatency time.Duration
+	// RetryAfter is sent with the 503s. Defaults to 1 second.
+	RetryAfter time.Duration
+}
+
+type shedder struct {
+	opts     Options
+	inFlight atomic.Int64
+	random   func() float64
+
+	mu      sync.Mutex
+	latency float64 // moving average, in nanoseconds
+}
+
+func Middleware(opts Options) server.Middleware {
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	return newShedder(opts).middleware
+}
+
+func newShedder(opts Options) *shedder {
+	return &shedder{opts: opts, random: rand.Float64}
+}
+
+func (s *shedder) middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		if s.shed(n) {
+			w.AddHeaderLine("Retry-After", strconv.Itoa(int(math.Ceil(s.opts.RetryAfter.Seconds()))))
+			server.ServeError(w, req, response.StatusCodeServiceUnavailable, ErrOverloaded)
+			return
+		}
+		start := time.Now()
+		next(w, req)
+		s.record(time.Since(start))
+	}
+}
+
+// shed decides whether to turn away a request that makes n in flight.
+func (s *shedder) shed(n int64) bool {
+	if s.opts.MaxInFlight > 0 && n > int64(s.opts.MaxInFlight) {
+		return true
+	}
+	if s.opts.MaxLatency <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	over := s.latency/float64(s.opts.MaxLatency) - 1
+	s.mu.Unlock()
+	return over > 0 && s.random() < min(over, maxShedFraction)
+}
+
+func (s *shedder) record(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latency == 0 {
+		s.latency = float64(d)
+		return
+	}
+	s.latency += smoothing * (float64(d) - s.latency)
+}
@@ -0,0 +1,97 @@
+package loadshed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest() *request.Request {
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+}
+
+func ok(w *response.Writer, _ *request.Request) {
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(0))
+}
+
+func TestMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := Middleware(Options{MaxInFlight: 2, RetryAfter: 1500 * time.Millisecond})(func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+		ok(w, req)
+	})
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, w := response.NewRecorder()
+			h(w, newRequest())
+		}()
+		<-started
+	}
+
+	// Test: A request over the in-flight limit gets 503 with Retry-After,
+	// from DefaultErrorHandler outside of a server
+	rec, w := response.NewRecorder()
+	h(w, newRequest())
+	assert.Equal(t, response.StatusCodeServiceUnavailable, rec.StatusCode)
+	assert.Contains(t, rec.HeaderLines, response.HeaderLine{Key: "Retry-After", Value: "2"})
+	assert.Equal(t, "Service Unavailable\n", rec.Body.String())
+
+	// Test: Once requests finish there's room again
+	close(release)
+	wg.Wait()
+	go func() { <-started }()
+	rec, w = response.NewRecorder()
+	h(w, newRequest())
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+}
+
+func TestMaxLatency(t *testing.T) {
+	s := newShedder(Options{MaxLatency: 100 * time.Millisecond, RetryAfter: time.Second})
+	roll := 0.5
+	s.random = func() float64 { return roll }
+
+	// Test: Nothing is shed while latency is under the limit
+	s.record(50 * time.Millisecond)
+	assert.False(t, s.shed(1))
+
+	// Test: The shed share grows with how far latency is over
+	s.latency = float64(140 * time.Millisecond)
+	assert.False(t, s.shed(1))
+	s.latency = float64(160 * time.Millisecond)
+	assert.True(t, s.shed(1))
+
+	// Test: Some requests always get through to measure recovery
+	s.latency = float64(10 * time.Second)
+	roll = 0.95
+	assert.False(t, s.shed(1))
+
+	// Test: Latency is a moving average
+	s.latency = float64(100 * time.Millisecond)
+	s.record(200 * time.Millisecond)
+	assert.InDelta(t, float64(110*time.Millisecond), s.latency, 1)
+
+	// Test: Shed requests get 503 and the handler isn't run
+	roll = 0
+	called := false
+	rec, w := response.NewRecorder()
+	s.middleware(func(w *response.Writer, req *request.Request) { called = true })(w, newRequest())
+	assert.False(t, called)
+	assert.Equal(t, response.StatusCodeServiceUnavailable, rec.StatusCode)
+	assert.Contains(t, rec.HeaderLines, response.HeaderLine{Key: "Retry-After", Value: "1"})
+}
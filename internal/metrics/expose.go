@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+// Content types of the two exposition formats.
+const (
+	TextContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	return r.write(w, false)
+}
+
+// WriteOpenMetrics writes every metric in the OpenMetrics text format.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, true)
+}
+
+func (r *Registry) write(w io.Writer, openMetrics bool) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw, openMetrics)
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer, openMetrics bool) {
+	// OpenMetrics names the family without the suffix its samples carry
+	name := f.name
+	if openMetrics && f.kind == kindCounter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	w.WriteString("# HELP " + name + " " + escapeHelp(f.help, openMetrics) + "\n")
+	w.WriteString("# TYPE " + name + " " + f.kind.String() + "\n")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != kindHistogram {
+			writeSample(w, f.name, f.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, f.name+"_bucket", f.labels, s.labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, f.name+"_sum", f.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// writeSample writes one line, with an extra label after the family's
+// ones if extraName is set.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + escapeLabel(extraValue) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// escapeHelp escapes help text. OpenMetrics escapes quotes in it as it does
+// in label values; the Prometheus format leaves them alone.
+func escapeHelp(v string, openMetrics bool) string {
+	if openMetrics {
+		return labelEscaper.Replace(v)
+	}
+	return helpEscaper.Replace(v)
+}
+
+// Handler serves r's metrics, in OpenMetrics to scrapers that ask for it
+// and in the Prometheus text format otherwise. It is a server.Handler.
+func Handler(r *Registry) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		var body strings.Builder
+		contentType, _ := req.Headers.Negotiate(TextContentType, OpenMetricsContentType)
+		if contentType == OpenMetricsContentType {
+			r.WriteOpenMetrics(&body)
+		} else {
+			contentType = TextContentType
+			r.WriteText(&body)
+		}
+		h := response.GetDefaultHeaders(body.Len())
+		h.Override("Content-Type", contentType)
+		h.AddVary("Accept")
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body.String()))
+	}
+}
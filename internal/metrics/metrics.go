@@ -0,0 +1,207 @@
+// Package metrics keeps counters, gauges and histograms and exposes them in
+// the Prometheus text format or OpenMetrics, without a client library.
+//
+// Each metric is a family of series told apart by label values, which are
+// passed positionally to Inc, Set, Observe and the like in the order the
+// label names were given when the metric was made.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram buckets for request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets, the first at start and each
+// factor times the one before.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindGauge
+	kindHistogram
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindCounter:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	}
+	return "histogram"
+}
+
+var (
+	validName  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	validLabel = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Registry holds metrics in the order they were made.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is one metric and all its series.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64  // counters and gauges
+	counts      []uint64 // histograms: per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// add makes a family, panicking on names that clash or aren't valid, as
+// those are mistakes in the program rather than in its input.
+func (r *Registry) add(f *family) *family {
+	if !validName.MatchString(f.name) {
+		panic("metrics: invalid metric name: " + f.name)
+	}
+	for _, l := range f.labels {
+		if !validLabel.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic("metrics: invalid label name: " + l)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.families {
+		if g.name == f.name {
+			panic("metrics: duplicate metric: " + f.name)
+		}
+	}
+	f.series = map[string]*series{}
+	if len(f.labels) == 0 {
+		// a metric without labels has its one series from the start, so
+		// it reads 0 rather than being missing
+		f.with(nil)
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// with returns the series for labelValues, making it if need be. The
+// caller holds f.mu.
+func (f *family) with(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only goes up, such as a count of requests. Its
+// name must end in _total.
+type Counter struct{ f *family }
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	if !strings.HasSuffix(name, "_total") {
+		panic("metrics: counter name must end in _total: " + name)
+	}
+	return &Counter{r.add(&family{name: name, help: help, kind: kindCounter, labels: labels})}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter decreased: " + c.f.name)
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.with(labelValues).value += v
+}
+
+// Gauge is a value that goes up and down, such as open connections.
+type Gauge struct{ f *family }
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.add(&family{name: name, help: help, kind: kindGauge, labels: labels})}
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.with(labelValues).value += v
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations, such as latencies, into buckets.
+type Histogram struct{ f *family }
+
+// NewHistogram makes a histogram with the given bucket upper bounds, which
+// must be increasing. A +Inf bucket is always added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	if !slices.IsSorted(buckets) || len(slices.Compact(slices.Clone(buckets))) != len(buckets) {
+		panic("metrics: histogram buckets must be increasing: " + name)
+	}
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = append(buckets, math.Inf(1))
+	}
+	return &Histogram{r.add(&family{name: name, help: help, kind: kindHistogram, labels: labels, buckets: buckets})}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.with(labelValues)
+	i, _ := slices.BinarySearch(h.f.buckets, v)
+	s.counts[i]++
+	s.count++
+	s.sum += v
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRegistry() *Registry {
+	reg := NewRegistry()
+	c := reg.NewCounter("jobs_total", "Jobs run.", "queue", "result")
+	c.Inc("mail", "ok")
+	c.Add(2, "mail", "ok")
+	c.Inc("a\"b\\c\nd", "failed")
+	g := reg.NewGauge("workers", "Workers busy.\nOr \"idle\".")
+	g.Set(4)
+	g.Dec()
+	h := reg.NewHistogram("job_seconds", "Job run time.", []float64{0.1, 1}, "queue")
+	h.Observe(0.1, "mail")
+	h.Observe(0.5, "mail")
+	h.Observe(3, "mail")
+	return reg
+}
+
+func TestText(t *testing.T) {
+	// Test: The Prometheus text format, series sorted by labels
+	var b strings.Builder
+	require.NoError(t, newRegistry().WriteText(&b))
+	assert.Equal(t, `# HELP jobs_total Jobs run.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b\\c\nd",result="failed"} 1
+jobs_total{queue="mail",result="ok"} 3
+# HELP workers Workers busy.\nOr "idle".
+# TYPE workers gauge
+workers 3
+# HELP job_seconds Job run time.
+# TYPE job_seconds histogram
+job_seconds_bucket{queue="mail",le="0.1"} 1
+job_seconds_bucket{queue="mail",le="1"} 2
+job_seconds_bucket{queue="mail",le="+Inf"} 3
+job_seconds_sum{queue="mail"} 3.6
+job_seconds_count{queue="mail"} 3
+`, b.String())
+}
+
+func TestOpenMetrics(t *testing.T) {
+	// Test: Counter families drop _total, quotes in help are escaped and
+	// the exposition ends with EOF
+	var b strings.Builder
+	require.NoError(t, newRegistry().WriteOpenMetrics(&b))
+	out := b.String()
+	assert.True(t, strings.HasPrefix(out, "# HELP jobs Jobs run.\n# TYPE jobs counter\njobs_total{"))
+	assert.Contains(t, out, `# HELP workers Workers busy.\nOr \"idle\".`)
+	assert.True(t, strings.HasSuffix(out, "job_seconds_count{queue=\"mail\"} 3\n# EOF\n"))
+}
+
+func TestMistakes(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("a_total", "", "x")
+
+	// Test: Bad names, duplicates and wrong label counts panic
+	assert.Panics(t, func() { reg.NewCounter("a", "") })
+	assert.Panics(t, func() { reg.NewGauge("a_total", "") })
+	assert.Panics(t, func() { reg.NewGauge("1a", "") })
+	assert.Panics(t, func() { reg.NewGauge("b", "", "le") })
+	assert.Panics(t, func() { reg.NewHistogram("c", "", []float64{2, 1}) })
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "y") })
+
+	// Test: Metrics without labels read 0 before they are used
+	var b strings.Builder
+	reg.NewGauge("idle", "")
+	require.NoError(t, reg.WriteText(&b))
+	assert.Contains(t, b.String(), "\nidle 0\n")
+
+	// Test: Helpers
+	assert.Equal(t, []float64{1, 2, 4}, ExponentialBuckets(1, 2, 3))
+}
+
+func TestHandler(t *testing.T) {
+	reg := newRegistry()
+	get := func(accept string) *response.Recorder {
+		req := &request.Request{Headers: headers.NewHeaders()}
+		if accept != "" {
+			req.Headers.Set("Accept", accept)
+		}
+		rec, w := response.NewRecorder()
+		Handler(reg)(w, req)
+		return rec
+	}
+
+	// Test: Plain scrapes get the text format
+	rec := get("")
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, TextContentType, rec.Headers["content-type"])
+	assert.Equal(t, "Accept", rec.Headers["vary"])
+	assert.Contains(t, rec.Body.String(), "workers 3\n")
+
+	// Test: Asking for an OpenMetrics version we don't speak gets text
+	rec = get("application/openmetrics-text;version=0.0.1,text/plain;q=0.5")
+	assert.Equal(t, TextContentType, rec.Headers["content-type"])
+
+	// Test: Prometheus's own Accept header gets OpenMetrics
+	rec = get("application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	assert.Equal(t, OpenMetricsContentType, rec.Headers["content-type"])
+	assert.True(t, strings.HasSuffix(rec.Body.String(), "# EOF\n"))
+}
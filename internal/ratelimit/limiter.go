@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket allows bursts of up to limit requests and refills at limit
+// per window, so a client that keeps to the average rate is never refused.
+type TokenBucket struct {
+	limit    int
+	window   time.Duration
+	perToken float64 // nanoseconds to refill one token
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(limit int, window time.Duration) *TokenBucket {
+	if limit < 1 || window <= 0 {
+		panic("ratelimit: limit and window must be positive")
+	}
+	return &TokenBucket{
+		limit:    limit,
+		window:   window,
+		perToken: float64(window) / float64(limit),
+		now:      time.Now,
+		buckets:  map[string]*bucket{},
+	}
+}
+
+func (tb *TokenBucket) Quota() (int, time.Duration) {
+	return tb.limit, tb.window
+}
+
+func (tb *TokenBucket) Allow(key string) Decision {
+	now := tb.now()
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.sweep(now)
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(tb.limit), last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = min(float64(tb.limit), b.tokens+float64(now.Sub(b.last))/tb.perToken)
+	b.last = now
+
+	d := Decision{Allowed: b.tokens >= 1}
+	if d.Allowed {
+		b.tokens--
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) * tb.perToken)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = time.Duration((float64(tb.limit) - b.tokens) * tb.perToken)
+	return d
+}
+
+// sweep drops buckets that have refilled, at most once a window.
+func (tb *TokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.lastSweep) < tb.window {
+		return
+	}
+	tb.lastSweep = now
+	for key, b := range tb.buckets {
+		if b.tokens+float64(now.Sub(b.last))/tb.perToken >= float64(tb.limit) {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+// SlidingWindow allows limit requests in any window-long stretch of time.
+// It estimates the count by weighting the previous fixed window by how much
+// of it still overlaps the sliding one, which needs two counters per key
+// rather than a timestamp per request.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	start      time.Time // of the current fixed window
+	prev, curr int
+}
+
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	if limit < 1 || window <= 0 {
+		panic("ratelimit: limit and window must be positive")
+	}
+	return &SlidingWindow{
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
+		counters: map[string]*counter{},
+	}
+}
+
+func (sw *SlidingWindow) Quota() (int, time.Duration) {
+	return sw.limit, sw.window
+}
+
+func (sw *SlidingWindow) Allow(key string) Decision {
+	now := sw.now()
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.sweep(now)
+
+	c, ok := sw.counters[key]
+	if !ok {
+		c = &counter{start: now}
+		sw.counters[key] = c
+	}
+	sw.advance(c, now)
+
+	d := Decision{Allowed: sw.estimate(c, now)+1 <= float64(sw.limit)}
+	if d.Allowed {
+		c.curr++
+	} else {
+		d.RetryAfter = sw.retryAfter(c, now)
+	}
+	d.Remaining = max(sw.limit-int(math.Ceil(sw.estimate(c, now))), 0)
+	// the current window's requests stop counting once the next one ends,
+	// the previous window's once this one does
+	switch {
+	case c.curr > 0:
+		d.Reset = c.start.Add(2 * sw.window).Sub(now)
+	case c.prev > 0:
+		d.Reset = c.start.Add(sw.window).Sub(now)
+	}
+	return d
+}
+
+// advance moves c's fixed windows forward to the one holding now.
+func (sw *SlidingWindow) advance(c *counter, now time.Time) {
+	n := now.Sub(c.start) / sw.window
+	if n <= 0 {
+		return
+	}
+	if n == 1 {
+		c.prev = c.curr
+	} else {
+		c.prev = 0
+	}
+	c.curr = 0
+	c.start = c.start.Add(n * sw.window)
+}
+
+func (sw *SlidingWindow) estimate(c *counter, now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(c.start))/float64(sw.window)
+	return float64(c.prev)*overlap + float64(c.curr)
+}
+
+// retryAfter works out when the estimate will next leave room for one
+// request: later in this window as the previous one's weight falls, or
+// once this window has itself become the previous one.
+func (sw *SlidingWindow) retryAfter(c *counter, now time.Time) time.Duration {
+	w := float64(sw.window)
+	elapsed := float64(now.Sub(c.start))
+	room := float64(sw.limit - 1)
+	if c.curr <= sw.limit-1 && c.prev > 0 {
+		return time.Duration(max(w-elapsed-(room-float64(c.curr))*w/float64(c.prev), 0))
+	}
+	return time.Duration(w - elapsed + max(w*(1-room/float64(c.curr)), 0))
+}
+
+// sweep drops counters that no longer count anything, at most once a
+// window.
+func (sw *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(sw.lastSweep) < sw.window {
+		return
+	}
+	sw.lastSweep = now
+	for key, c := range sw.counters {
+		if now.Sub(c.start) >= 2*sw.window {
+			delete(sw.counters, key)
+		}
+	}
+}
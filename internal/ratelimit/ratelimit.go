@@ -0,0 +1,161 @@
+// Package ratelimit is middleware that limits how often each client may
+// make requests, answering 429 Too Many Requests once it is over its quota
+// and advertising the quota with the RateLimit and RateLimit-Policy fields
+// (draft-ietf-httpapi-ratelimit-headers).
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"HTTPFTCP/internal/auth"
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/headers/sfv"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// Decision is a Limiter's answer for one request.
+type Decision struct {
+	Allowed bool
+	// Remaining is how many more requests the client may make now.
+	Remaining int
+	// Reset is how long until the quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is how long a refused client should wait.
+	RetryAfter time.Duration
+}
+
+// Limiter tracks request counts per key. Implementations must be safe for
+// concurrent use.
+type Limiter interface {
+	// Allow records a request for key, unless it is over the limit.
+	Allow(key string) Decision
+	// Quota returns the number of requests allowed per window.
+	Quota() (limit int, window time.Duration)
+}
+
+// KeyFunc picks the key a request is counted under.
+type KeyFunc func(req *request.Request) string
+
+// ByIP counts requests per client IP address.
+func ByIP(req *request.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByHeader counts requests per value of the named field, such as an API
+// key. Requests without it are counted per IP address.
+func ByHeader(name string) KeyFunc {
+	return func(req *request.Request) string {
+		if v, ok := req.Headers.Get(name); ok && v != "" {
+			return "header:" + v
+		}
+		return ByIP(req)
+	}
+}
+
+// ByPrincipal counts requests per authenticated principal, so it must run
+// after the auth middleware. Anonymous requests are counted per IP address.
+func ByPrincipal(req *request.Request) string {
+	if p := auth.FromRequest(req); p != nil {
+		return "principal:" + p.Scheme + ":" + p.Name
+	}
+	return ByIP(req)
+}
+
+type Options struct {
+	Limiter Limiter
+	// Key defaults to ByIP.
+	Key KeyFunc
+	// Name identifies the policy in the RateLimit fields. Defaults to
+	// "default".
+	Name string
+}
+
+// Middleware counts each request against opts.Limiter and refuses those
+// over the limit with 429 and Retry-After. Every response carries the
+// RateLimit and RateLimit-Policy fields; stacking several of these
+// middlewares lists each policy.
+func Middleware(opts Options) server.Middleware {
+	if opts.Limiter == nil {
+		panic("ratelimit: no limiter")
+	}
+	if opts.Key == nil {
+		opts.Key = ByIP
+	}
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	limit, window := opts.Limiter.Quota()
+	policy, err := sfv.MarshalList(sfv.List{sfv.Item{Value: opts.Name, Params: sfv.Params{
+		{Key: "q", Value: int64(limit)},
+		{Key: "w", Value: seconds(window)},
+	}}})
+	if err != nil {
+		panic("ratelimit: bad policy name: " + err.Error())
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			d := opts.Limiter.Allow(opts.Key(req))
+			rl := &rateLimitSink{Writer: w, policy: policy, state: state(opts.Name, d)}
+			if !d.Allowed {
+				if err := rl.writeTooManyRequests(d); err != nil {
+					log.Printf("ratelimit: error writing response: %v", err)
+				}
+				return
+			}
+			next(response.NewSinkWriter(rl), req)
+		}
+	}
+}
+
+// state is the RateLimit value for d.
+func state(name string, d Decision) string {
+	v, _ := sfv.MarshalList(sfv.List{sfv.Item{Value: name, Params: sfv.Params{
+		{Key: "r", Value: int64(d.Remaining)},
+		{Key: "t", Value: seconds(d.Reset)},
+	}}})
+	return v
+}
+
+// seconds rounds d up to whole seconds, as the fields and Retry-After
+// want.
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// rateLimitSink adds the RateLimit fields to the handler's headers.
+type rateLimitSink struct {
+	*response.Writer
+	policy string
+	state  string
+}
+
+func (r *rateLimitSink) WriteHeaders(h headers.Headers) error {
+	h.Set("RateLimit-Policy", r.policy)
+	h.Set("RateLimit", r.state)
+	return r.Writer.WriteHeaders(h)
+}
+
+func (r *rateLimitSink) writeTooManyRequests(d Decision) error {
+	body := []byte("Too Many Requests\n")
+	if err := r.WriteStatusLine(response.StatusCodeTooManyRequests); err != nil {
+		return err
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Retry-After", strconv.FormatInt(max(seconds(d.RetryAfter), 1), 10))
+	if err := r.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := r.WriteBody(body)
+	return err
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/auth"
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClock() *clock {
+	return &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestTokenBucket(t *testing.T) {
+	c := newClock()
+	tb := NewTokenBucket(3, 3*time.Second)
+	tb.now = c.now
+
+	// Test: A full bucket allows a burst of limit requests
+	for i := 2; i >= 0; i-- {
+		d := tb.Allow("a")
+		require.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+	}
+	d := tb.Allow("a")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, 3*time.Second, d.Reset)
+
+	// Test: Keys have their own buckets
+	assert.True(t, tb.Allow("b").Allowed)
+
+	// Test: Tokens refill at limit per window
+	c.advance(1500 * time.Millisecond)
+	d = tb.Allow("a")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 2500*time.Millisecond, d.Reset)
+	d = tb.Allow("a")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+
+	// Test: Full buckets are swept
+	c.advance(10 * time.Second)
+	tb.Allow("c")
+	assert.Len(t, tb.buckets, 1)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c := newClock()
+	sw := NewSlidingWindow(4, 10*time.Second)
+	sw.now = c.now
+
+	// Test: Limit requests are allowed in one window
+	for i := 3; i >= 0; i-- {
+		d := sw.Allow("a")
+		require.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+		assert.Equal(t, 20*time.Second, d.Reset)
+	}
+	d := sw.Allow("a")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 10*time.Second+2500*time.Millisecond, d.RetryAfter)
+
+	// Test: Previous window still counts in proportion to its overlap
+	c.advance(12500 * time.Millisecond)
+	d = sw.Allow("a")
+	require.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	d = sw.Allow("a")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 2500*time.Millisecond, d.RetryAfter)
+	c.advance(d.RetryAfter)
+	assert.True(t, sw.Allow("a").Allowed)
+
+	// Test: A window long gone counts for nothing
+	c.advance(30 * time.Second)
+	d = sw.Allow("a")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 3, d.Remaining)
+
+	// Test: Idle counters are swept
+	c.advance(30 * time.Second)
+	sw.Allow("b")
+	assert.Len(t, sw.counters, 1)
+}
+
+func newRequest(remoteAddr string, fields ...string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+		RemoteAddr:  remoteAddr,
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	return req
+}
+
+func TestKeys(t *testing.T) {
+	// Test: Keys fall back to the client IP
+	req := newRequest("192.0.2.1:5000")
+	assert.Equal(t, "ip:192.0.2.1", ByIP(req))
+	assert.Equal(t, "ip:2001:db8::1", ByIP(newRequest("[2001:db8::1]:80")))
+	assert.Equal(t, "ip:192.0.2.1", ByHeader("X-Api-Key")(req))
+	assert.Equal(t, "ip:192.0.2.1", ByPrincipal(req))
+
+	req = newRequest("192.0.2.1:5000", "X-Api-Key", "k1")
+	assert.Equal(t, "header:k1", ByHeader("X-Api-Key")(req))
+
+	// Test: Authenticated requests are counted per principal
+	hash, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	require.NoError(t, err)
+	basic := auth.NewBasic("r", auth.Credentials{"alice": string(hash)})
+	var key string
+	h := auth.Middleware(auth.Options{Authenticators: []auth.Authenticator{basic}})(
+		func(_ *response.Writer, req *request.Request) { key = ByPrincipal(req) })
+	_, w := response.NewRecorder()
+	h(w, newRequest("192.0.2.1:5000", "Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:pw"))))
+	assert.Equal(t, "principal:basic:alice", key)
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newClock()
+	tb := NewTokenBucket(2, time.Minute)
+	tb.now = c.now
+	calls := 0
+	h := Middleware(Options{Limiter: tb})(func(w *response.Writer, _ *request.Request) {
+		calls++
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	serve := func(addr string) *response.Recorder {
+		rec, w := response.NewRecorder()
+		h(w, newRequest(addr))
+		return rec
+	}
+
+	// Test: Allowed responses carry the policy and what's left of it
+	rec := serve("192.0.2.1:1000")
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, `"default";q=2;w=60`, rec.Headers["ratelimit-policy"])
+	assert.Equal(t, `"default";r=1;t=30`, rec.Headers["ratelimit"])
+
+	// Test: Over the limit is 429 with Retry-After and the handler isn't run
+	serve("192.0.2.1:1001")
+	rec = serve("192.0.2.1:1002")
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, response.StatusCodeTooManyRequests, rec.StatusCode)
+	assert.Equal(t, "30", rec.Headers["retry-after"])
+	assert.Equal(t, `"default";r=0;t=60`, rec.Headers["ratelimit"])
+	assert.Equal(t, "Too Many Requests\n", rec.Body.String())
+
+	// Test: Another client is unaffected
+	assert.Equal(t, response.StatusCodeSuccess, serve("192.0.2.2:1000").StatusCode)
+
+	// Test: Stacked policies are listed together
+	h = Middleware(Options{Limiter: NewSlidingWindow(100, time.Hour), Name: "hourly"})(h)
+	rec = serve("192.0.2.3:1000")
+	assert.Equal(t, `"default";q=2;w=60, "hourly";q=100;w=3600`, rec.Headers["ratelimit-policy"])
+	assert.Equal(t, `"default";r=1;t=30, "hourly";r=99;t=7200`, rec.Headers["ratelimit"])
+}
@@ -0,0 +1,30 @@
+package request
+
+import (
+	"errors"
+
+	"HTTPFTCP/internal/headers"
+)
+
+// ErrNoCookie is returned by Cookie when the request has no cookie with
+// that name.
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookies returns the cookies sent in the Cookie header.
+func (r *Request) Cookies() []*headers.Cookie {
+	v, ok := r.Headers.Get("Cookie")
+	if !ok {
+		return nil
+	}
+	return headers.ParseCookies(v)
+}
+
+// Cookie returns the first cookie called name.
+func (r *Request) Cookie(name string) (*headers.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
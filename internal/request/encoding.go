@@ -0,0 +1,105 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrUnsupportedEncoding means the body uses a Content-Encoding we
+	// can't decode. Servers should answer 415 Unsupported Media Type.
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	// ErrDecodedBodyTooLarge means the decoded body went over the limit
+	// passed to DecodeBody. Servers should answer 413 Content Too Large.
+	ErrDecodedBodyTooLarge = errors.New("decoded body too large")
+)
+
+// DecodeBody undoes the Content-Encoding of r.Body, replacing it with the
+// decoded bytes and updating Content-Length to match. Codings are removed in
+// the reverse of the order they were applied. Decoding stops with
+// ErrDecodedBodyTooLarge once more than maxSize bytes come out, which keeps a
+// small compressed upload from expanding without bound.
+func (r *Request) DecodeBody(maxSize int64) error {
+	ce, ok := r.Headers.Get("Content-Encoding")
+	if !ok {
+		return nil
+	}
+	var codings []string
+	for _, c := range strings.Split(ce, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && c != "identity" {
+			codings = append(codings, c)
+		}
+	}
+	body, err := r.ReadBody()
+	if err != nil {
+		return err
+	}
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoded, err := decode(codings[i], body, maxSize)
+		if err != nil {
+			return err
+		}
+		body = decoded
+	}
+	r.Body = body
+	delete(r.Headers, "content-encoding")
+	r.Headers.Override("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func decode(coding string, body []byte, maxSize int64) ([]byte, error) {
+	var rd io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("malformed gzip body: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	case "deflate":
+		// some clients send raw deflate instead of the zlib format
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			fr := flate.NewReader(bytes.NewReader(body))
+			defer fr.Close()
+			rd = fr
+		} else {
+			defer zr.Close()
+			rd = zr
+		}
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)+1))
+		if err != nil {
+			return nil, fmt.Errorf("malformed zstd body: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, coding)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(rd, maxSize+1))
+	if int64(len(decoded)) > maxSize {
+		return nil, ErrDecodedBodyTooLarge
+	}
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrDecodedBodyTooLarge
+		}
+		return nil, fmt.Errorf("malformed %s body: %w", coding, err)
+	}
+	return decoded, nil
+}
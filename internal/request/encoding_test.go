@@ -0,0 +1,57 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	// Test: gzip body is decoded and headers updated
+	r := &Request{Headers: headers.Headers{"content-encoding": "gzip", "content-length": "99"}, Body: gzipped(t, `{"a":1}`)}
+	require.NoError(t, r.DecodeBody(1024))
+	assert.Equal(t, `{"a":1}`, string(r.Body))
+	assert.Equal(t, "7", r.Headers["content-length"])
+	_, ok := r.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+
+	// Test: Stacked codings are removed in reverse order
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	r = &Request{Headers: headers.Headers{"content-encoding": "gzip, zstd"}, Body: enc.EncodeAll(gzipped(t, "hello"), nil)}
+	require.NoError(t, r.DecodeBody(1024))
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Zip bomb stops at the limit
+	r = &Request{Headers: headers.Headers{"content-encoding": "gzip"}, Body: gzipped(t, strings.Repeat("a", 1<<20))}
+	require.ErrorIs(t, r.DecodeBody(1024), ErrDecodedBodyTooLarge)
+
+	// Test: Unknown coding
+	r = &Request{Headers: headers.Headers{"content-encoding": "br"}, Body: []byte("x")}
+	require.ErrorIs(t, r.DecodeBody(1024), ErrUnsupportedEncoding)
+
+	// Test: Garbage gzip body
+	r = &Request{Headers: headers.Headers{"content-encoding": "gzip"}, Body: []byte("not gzip")}
+	require.Error(t, r.DecodeBody(1024))
+
+	// Test: No Content-Encoding leaves the body alone
+	r = &Request{Headers: headers.NewHeaders(), Body: []byte("plain")}
+	require.NoError(t, r.DecodeBody(1))
+	assert.Equal(t, "plain", string(r.Body))
+}
@@ -0,0 +1,60 @@
+package request
+
+import "errors"
+
+// The parse errors, for use with errors.Is. The parser returns them
+// wrapped in a *ParseError along with what it choked on.
+var (
+	// ErrMalformedRequestLine means the request line isn't
+	// "method SP request-target SP HTTP-version".
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	// ErrInvalidMethod means the method isn't made of upper-case letters.
+	ErrInvalidMethod = errors.New("invalid method")
+	// ErrUnsupportedVersion means a well-formed HTTP version other than
+	// 1.1.
+	ErrUnsupportedVersion = errors.New("unsupported HTTP version")
+	// ErrMalformedHeader means a header field line couldn't be parsed.
+	ErrMalformedHeader = errors.New("malformed header")
+	// ErrInvalidContentLength means Content-Length isn't a valid length.
+	ErrInvalidContentLength = errors.New("invalid Content-Length")
+	// ErrBodyTooLong means more body arrived than Content-Length allows.
+	ErrBodyTooLong = errors.New("body longer than Content-Length")
+	// ErrBodyTooShort means the connection ended before Content-Length
+	// bytes of body arrived.
+	ErrBodyTooShort = errors.New("body shorter than Content-Length")
+	// ErrIncomplete means the connection ended before the request's head
+	// did.
+	ErrIncomplete = errors.New("incomplete request")
+)
+
+// ParseError is the error returned for a request that couldn't be parsed.
+// Err is one of the errors above and Detail says what was wrong with this
+// request. Detail quotes the client's input, so it belongs in logs rather
+// than in responses.
+type ParseError struct {
+	Err    error
+	Detail string
+}
+
+func (e *ParseError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode is the status the server should answer the error with.
+func (e *ParseError) StatusCode() int {
+	if e.Err == ErrUnsupportedVersion {
+		return 505
+	}
+	return 400
+}
+
+func parseError(err error, detail string) *ParseError {
+	return &ParseError{Err: err, Detail: detail}
+}
@@ -0,0 +1,76 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Path returns the request target without its query string.
+func (r *Request) Path() string {
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Query parses the query string of the request target.
+func (r *Request) Query() (url.Values, error) {
+	_, rawQuery, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return url.ParseQuery(rawQuery)
+}
+
+// ParseForm fills r.Form from the query string and, for form-encoded
+// bodies, r.PostForm from the body. Body values come first in r.Form.
+// Bodies of any other type, such as JSON, are left alone for the handler,
+// with r.PostForm empty; multipart ones are read by ParseMultipartForm. It
+// is safe to call more than once.
+func (r *Request) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+	form, err := r.Query()
+	if err != nil {
+		return fmt.Errorf("malformed query string: %w", err)
+	}
+	r.PostForm = url.Values{}
+	if _, ok := r.Headers.Get("Content-Type"); ok {
+		mediaType, err := r.mediaType()
+		if err != nil {
+			return err
+		}
+		if mediaType == "application/x-www-form-urlencoded" {
+			body, err := r.ReadBody()
+			if err != nil {
+				return err
+			}
+			r.PostForm, err = url.ParseQuery(string(body))
+			if err != nil {
+				return fmt.Errorf("malformed form body: %w", err)
+			}
+		}
+	}
+	r.Form = url.Values{}
+	for k, vs := range r.PostForm {
+		r.Form[k] = append(r.Form[k], vs...)
+	}
+	for k, vs := range form {
+		r.Form[k] = append(r.Form[k], vs...)
+	}
+	return nil
+}
+
+// FormValue returns the first value for key from ParseForm, or "" if there
+// is none or the form couldn't be parsed.
+func (r *Request) FormValue(key string) string {
+	if err := r.ParseForm(); err != nil {
+		return ""
+	}
+	return r.Form.Get(key)
+}
+
+func (r *Request) mediaType() (string, error) {
+	mediaType, _, err := r.Headers.GetMediaType()
+	if err != nil {
+		return "", fmt.Errorf("malformed Content-Type: %w", err)
+	}
+	return mediaType, nil
+}
@@ -0,0 +1,151 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForm(t *testing.T) {
+	// Test: Query string and urlencoded body
+	r := &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/submit?a=1&b=2", HttpVersion: "1.1"},
+		Headers:     headers.Headers{"content-type": "application/x-www-form-urlencoded; charset=utf-8"},
+		Body:        []byte("a=body&c=hello+world"),
+	}
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"body", "1"}, r.Form["a"])
+	assert.Equal(t, "2", r.FormValue("b"))
+	assert.Equal(t, "hello world", r.PostForm.Get("c"))
+	assert.Empty(t, r.PostForm.Get("b"))
+	assert.Equal(t, "/submit", r.Path())
+
+	// Test: Other body types are ignored, keeping the query string
+	r = &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/submit?q=1"},
+		Headers:     headers.Headers{"content-type": "application/json"},
+		Body:        []byte(`{"q":2}`),
+	}
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "1", r.FormValue("q"))
+	assert.Empty(t, r.PostForm)
+	assert.Equal(t, `{"q":2}`, string(r.Body))
+
+	// Test: Malformed input is still an error
+	r = &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/submit"},
+		Headers:     headers.Headers{"content-type": "application/x-www-form-urlencoded"},
+		Body:        []byte("a=%zz"),
+	}
+	assert.Error(t, r.ParseForm())
+	r.Headers = headers.Headers{"content-type": "text/"}
+	assert.Error(t, r.ParseForm())
+	assert.Empty(t, r.FormValue("a"))
+}
+
+func multipartRequest(t *testing.T, fileSize int) *Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("name", "gopher"))
+	fw, err := mw.CreateFormFile("upload", "data.bin")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(strings.Repeat("x", fileSize)))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/upload"},
+		Headers:     headers.Headers{"content-type": mw.FormDataContentType()},
+		Body:        body.Bytes(),
+	}
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	// Test: Fields and small file kept in memory
+	r := multipartRequest(t, 10)
+	form, err := r.ParseMultipartForm(MultipartLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gopher"}, form.Value["name"])
+	assert.Equal(t, "gopher", r.FormValue("name"))
+	require.Len(t, form.File["upload"], 1)
+	fh := form.File["upload"][0]
+	assert.Equal(t, "data.bin", fh.Filename)
+	assert.Equal(t, int64(10), fh.Size)
+	assert.Empty(t, fh.tmpFile)
+
+	// Test: Large file spills to disk and is removed
+	r = multipartRequest(t, 100)
+	form, err = r.ParseMultipartForm(MultipartLimits{MaxMemory: 16})
+	require.NoError(t, err)
+	fh = form.File["upload"][0]
+	require.NotEmpty(t, fh.tmpFile)
+	f, err := fh.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 100), string(data))
+	require.NoError(t, form.RemoveAll())
+	assert.NoFileExists(t, fh.tmpFile)
+
+	// Test: Per-part limit
+	r = multipartRequest(t, 100)
+	_, err = r.ParseMultipartForm(MultipartLimits{MaxPartSize: 50})
+	require.ErrorIs(t, err, ErrPartTooLarge)
+
+	// Test: Total limit
+	r = multipartRequest(t, 100)
+	_, err = r.ParseMultipartForm(MultipartLimits{MaxTotalSize: 50})
+	require.ErrorIs(t, err, ErrMultipartTooLarge)
+
+	// Test: Streaming reader yields parts in order
+	r = multipartRequest(t, 5)
+	mr, err := r.MultipartReader(MultipartLimits{})
+	require.NoError(t, err)
+	p, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "name", p.FormName)
+	assert.False(t, p.IsFile())
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.True(t, p.IsFile())
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: A body still on the connection is streamed through, not kept
+	onWire := func(r *Request) *chunkReader {
+		return &chunkReader{
+			data: "POST /upload HTTP/1.1\r\nContent-Type: " + r.Headers["content-type"] +
+				"\r\nContent-Length: " + strconv.Itoa(len(r.Body)) + "\r\n\r\n" + string(r.Body),
+			numBytesPerRead: 4096,
+		}
+	}
+	r, err = HeadFromReader(onWire(multipartRequest(t, 100)))
+	require.NoError(t, err)
+	form, err = r.ParseMultipartForm(MultipartLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gopher"}, form.Value["name"])
+	assert.Equal(t, int64(100), form.File["upload"][0].Size)
+	assert.Empty(t, r.Body)
+
+	// Test: So the limits stop an upload long before all of it is read
+	cr := onWire(multipartRequest(t, 1<<20))
+	r, err = HeadFromReader(cr)
+	require.NoError(t, err)
+	_, err = r.ParseMultipartForm(MultipartLimits{MaxTotalSize: 64 << 10})
+	require.ErrorIs(t, err, ErrMultipartTooLarge)
+	assert.Less(t, cr.pos, 128<<10)
+	assert.Empty(t, r.Body)
+
+	// Test: Not multipart
+	r = &Request{Headers: headers.Headers{"content-type": "text/plain"}}
+	_, err = r.MultipartReader(MultipartLimits{})
+	require.ErrorIs(t, err, ErrNotMultipart)
+}
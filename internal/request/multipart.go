@@ -0,0 +1,251 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+)
+
+var (
+	// ErrNotMultipart means the body isn't multipart/form-data.
+	ErrNotMultipart = errors.New("request body is not multipart/form-data")
+	// ErrPartTooLarge means a single part went over MultipartLimits.MaxPartSize.
+	ErrPartTooLarge = errors.New("multipart part too large")
+	// ErrMultipartTooLarge means the parts together went over
+	// MultipartLimits.MaxTotalSize, or there were more than MaxParts.
+	ErrMultipartTooLarge = errors.New("multipart body too large")
+)
+
+// MultipartLimits bounds what a MultipartReader will accept. Zero values
+// pick the defaults.
+type MultipartLimits struct {
+	// MaxPartSize caps each part's content. Defaults to 32 MiB.
+	MaxPartSize int64
+	// MaxTotalSize caps the content of all parts together. Defaults to 64 MiB.
+	MaxTotalSize int64
+	// MaxParts caps the number of parts. Defaults to 1000.
+	MaxParts int
+	// MaxMemory is how much of a file part ParseMultipartForm keeps in
+	// memory before spilling it to a temp file. Defaults to 1 MiB.
+	MaxMemory int64
+}
+
+func (l MultipartLimits) withDefaults() MultipartLimits {
+	if l.MaxPartSize <= 0 {
+		l.MaxPartSize = 32 << 20
+	}
+	if l.MaxTotalSize <= 0 {
+		l.MaxTotalSize = 64 << 20
+	}
+	if l.MaxParts <= 0 {
+		l.MaxParts = 1000
+	}
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = 1 << 20
+	}
+	return l
+}
+
+// MultipartReader walks the parts of a multipart/form-data body one at a
+// time, enforcing its limits as the parts are read.
+type MultipartReader struct {
+	mr     *multipart.Reader
+	limits MultipartLimits
+	parts  int
+	total  int64
+}
+
+// Part is one part of a multipart/form-data body. Read it before asking for
+// the next one.
+type Part struct {
+	Header textproto.MIMEHeader
+	// FormName is the name parameter of Content-Disposition.
+	FormName string
+	// FileName is the filename parameter, empty for plain fields.
+	FileName string
+
+	p    *multipart.Part
+	mr   *MultipartReader
+	size int64
+}
+
+// Read reads the part's content, failing with ErrPartTooLarge or
+// ErrMultipartTooLarge once a limit is crossed.
+func (p *Part) Read(b []byte) (int, error) {
+	n, err := p.p.Read(b)
+	p.size += int64(n)
+	p.mr.total += int64(n)
+	if p.size > p.mr.limits.MaxPartSize {
+		return n, ErrPartTooLarge
+	}
+	if p.mr.total > p.mr.limits.MaxTotalSize {
+		return n, ErrMultipartTooLarge
+	}
+	return n, err
+}
+
+// IsFile reports whether the part is a file upload rather than a field.
+func (p *Part) IsFile() bool {
+	return p.FileName != ""
+}
+
+// MultipartReader returns a reader over r's multipart/form-data body. A body
+// that hasn't been read yet is streamed from the connection as the parts
+// are read, so the limits apply before anything over them is buffered.
+func (r *Request) MultipartReader(limits MultipartLimits) (*MultipartReader, error) {
+	mediaType, params, err := r.Headers.GetMediaType()
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("%w: missing boundary", ErrNotMultipart)
+	}
+	return &MultipartReader{
+		mr:     multipart.NewReader(r.bodyReader(), boundary),
+		limits: limits.withDefaults(),
+	}, nil
+}
+
+// NextPart returns the next part, or io.EOF after the last one.
+func (m *MultipartReader) NextPart() (*Part, error) {
+	p, err := m.mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	m.parts++
+	if m.parts > m.limits.MaxParts {
+		return nil, ErrMultipartTooLarge
+	}
+	return &Part{
+		Header:   p.Header,
+		FormName: p.FormName(),
+		FileName: p.FileName(),
+		p:        p,
+		mr:       m,
+	}, nil
+}
+
+// MultipartForm is a fully read multipart/form-data body.
+type MultipartForm struct {
+	Value map[string][]string
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes an uploaded file. Small files are kept in memory and
+// larger ones in a temp file until RemoveAll is called.
+type FileHeader struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+
+	content []byte
+	tmpFile string
+}
+
+// Open returns the file's content.
+func (f *FileHeader) Open() (io.ReadCloser, error) {
+	if f.tmpFile != "" {
+		return os.Open(f.tmpFile)
+	}
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// RemoveAll deletes any temp files backing the form.
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if fh.tmpFile == "" {
+				continue
+			}
+			if err := os.Remove(fh.tmpFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseMultipartForm reads every part of r's multipart/form-data body. Field
+// values are also added to r.Form and r.PostForm. The caller should call
+// RemoveAll on the result when done with the files.
+func (r *Request) ParseMultipartForm(limits MultipartLimits) (*MultipartForm, error) {
+	mr, err := r.MultipartReader(limits)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	form := &MultipartForm{
+		Value: map[string][]string{},
+		File:  map[string][]*FileHeader{},
+	}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		if p.FormName == "" {
+			continue
+		}
+		if !p.IsFile() {
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, p); err != nil {
+				form.RemoveAll()
+				return nil, err
+			}
+			form.Value[p.FormName] = append(form.Value[p.FormName], buf.String())
+			r.Form.Add(p.FormName, buf.String())
+			r.PostForm.Add(p.FormName, buf.String())
+			continue
+		}
+		fh, err := readFilePart(p, mr.limits.MaxMemory)
+		if fh != nil {
+			form.File[p.FormName] = append(form.File[p.FormName], fh)
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+	}
+}
+
+// readFilePart keeps up to maxMemory bytes of p in memory and spills the
+// rest, along with what was buffered, to a temp file.
+func readFilePart(p *Part, maxMemory int64) (*FileHeader, error) {
+	fh := &FileHeader{Filename: p.FileName, Header: p.Header}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, p, maxMemory+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n <= maxMemory {
+		fh.content = buf.Bytes()
+		fh.Size = n
+		return fh, nil
+	}
+
+	f, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// record the file first so RemoveAll cleans it up on failure
+	fh.tmpFile = f.Name()
+	size, err := io.Copy(f, io.MultiReader(&buf, p))
+	if err != nil {
+		return fh, err
+	}
+	fh.Size = size
+	return fh, nil
+}
@@ -7,7 +7,8 @@ import (
 	"bytes"
 	"errors"
 	"HTTPFTCP/internal/headers"
-	"strconv"
+	"net/url"
+	"context"
 )
 
 type Request struct {
@@ -15,8 +16,25 @@ type Request struct {
 	Headers     headers.Headers
 	Body        []byte
 
+	// Form holds query string and body values once ParseForm has run, and
+	// PostForm just the body values.
+	Form     url.Values
+	PostForm url.Values
+
+	// RemoteAddr is the client's network address, as "host:port". The
+	// server sets it; it is empty for requests built by hand.
+	RemoteAddr string
+
 	state          requestState
-	bodyLengthRead int
+	bodyLengthRead int64
+	ctx            context.Context
+
+	// src and buf hold what's left of the connection until the body is read
+	src         io.Reader
+	buf         []byte
+	readToIndex int
+	onContinue  func()
+	onBodyRead  func()
 }
 
 type RequestLine struct {
@@ -38,41 +56,230 @@ const crlf = "\r\n"
 const bufferSize = 8
 
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize, bufferSize)
-	readToIndex := 0
+	req, err := HeadFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := req.ReadBody(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// HeadFromReader parses the request line and headers from reader and stops
+// there, leaving the body to ReadBody. Servers use it so that a client
+// waiting on Expect: 100-continue isn't waited on in turn.
+func HeadFromReader(reader io.Reader) (*Request, error) {
 	req := &Request{
 		state:   requestStateInitialized,
 		Headers: headers.NewHeaders(),
 		Body:    make([]byte, 0),
+		src:     reader,
+		buf:     make([]byte, bufferSize, bufferSize),
+	}
+	if err := req.readUntil(requestStateParsingBody); err != nil {
+		return nil, err
 	}
-	for req.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	return req, nil
+}
+
+// ReadBody reads the rest of the body into r.Body, if that hasn't happened
+// yet, and returns it. Before reading a body the client is holding back
+// with Expect: 100-continue it calls the function set with OnContinue.
+func (r *Request) ReadBody() ([]byte, error) {
+	// src is nil for requests built by hand rather than parsed
+	if r.state != requestStateDone && r.src != nil {
+		r.sendContinue()
+		if err := r.readUntil(requestStateDone); err != nil {
+			return nil, err
 		}
+	}
+	r.bodyRead()
+	return r.Body, nil
+}
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
+func (r *Request) sendContinue() {
+	if r.onContinue != nil && r.ExpectsContinue() {
+		if n, ok, _ := r.Headers.GetInt("Content-Length"); ok && n > 0 {
+			r.onContinue()
+		}
+		r.onContinue = nil
+	}
+}
+
+func (r *Request) bodyRead() {
+	if f := r.onBodyRead; f != nil {
+		r.onBodyRead = nil
+		f()
+	}
+}
+
+// bodyReader returns a reader over the body. If the body hasn't been read
+// yet it comes straight from the connection without being kept in r.Body,
+// so large bodies can be handled a piece at a time; ReadBody afterwards
+// only returns what the reader left.
+func (r *Request) bodyReader() io.Reader {
+	if r.state == requestStateDone || r.src == nil {
+		return bytes.NewReader(r.Body)
+	}
+	return &bodyStream{r: r}
+}
+
+type bodyStream struct {
+	r *Request
+}
+
+func (b *bodyStream) Read(p []byte) (int, error) {
+	r := b.r
+	if r.state == requestStateDone {
+		return 0, io.EOF
+	}
+	r.sendContinue()
+	contentLen, ok, err := r.Headers.GetInt("Content-Length")
+	if err != nil {
+		return 0, parseError(ErrInvalidContentLength, err.Error())
+	}
+	remaining := contentLen - r.bodyLengthRead
+	if !ok || remaining <= 0 {
+		r.state = requestStateDone
+		r.bodyRead()
+		return 0, io.EOF
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	var n int
+	if r.readToIndex > 0 {
+		// what was read along with the headers comes first
+		n = copy(p, r.buf[:r.readToIndex])
+		copy(r.buf, r.buf[n:r.readToIndex])
+		r.readToIndex -= n
+	} else {
+		n, err = r.src.Read(p)
+		if n == 0 && err != nil {
 			if errors.Is(err, io.EOF) {
-				if req.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.state, numBytesRead)
-				}
-				break
+				return 0, parseError(ErrBodyTooShort, fmt.Sprintf("got %d bytes", r.bodyLengthRead))
 			}
-			return nil, err
+			return 0, err
 		}
-		readToIndex += numBytesRead
+	}
+	r.bodyLengthRead += int64(n)
+	if r.bodyLengthRead == contentLen {
+		r.state = requestStateDone
+		r.bodyRead()
+	}
+	return n, nil
+}
+
+// Buffered returns what was read from the source past the end of the
+// request, such as the first bytes of the protocol a client switches to
+// straight after an Upgrade request. It is nil until the body has been
+// read.
+func (r *Request) Buffered() []byte {
+	if r.state != requestStateDone || r.readToIndex == 0 {
+		return nil
+	}
+	return r.buf[:r.readToIndex]
+}
+
+// ExpectsContinue reports whether the client sent Expect: 100-continue and
+// so may hold the body back until it hears 100 Continue. A handler can
+// still answer 413 or 417 without ever reading it.
+func (r *Request) ExpectsContinue() bool {
+	v, ok := r.Headers.Get("Expect")
+	return ok && strings.EqualFold(strings.TrimSpace(v), "100-continue")
+}
+
+// OnContinue sets the function ReadBody calls before reading a body held
+// back with Expect: 100-continue. The server uses it to send 100 Continue.
+func (r *Request) OnContinue(f func()) {
+	r.onContinue = f
+}
+
+// OnBodyRead sets a function ReadBody calls once the whole request has
+// been read. The server uses it to start watching for the client hanging
+// up, which it can't do while the body is still arriving.
+func (r *Request) OnBodyRead(f func()) {
+	r.onBodyRead = f
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
+// readUntil parses what's buffered and reads more from the source until
+// the parser reaches state until.
+func (r *Request) readUntil(until requestState) error {
+	for {
+		numBytesParsed, err := r.parse(r.buf[:r.readToIndex], until)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		copy(r.buf, r.buf[numBytesParsed:r.readToIndex])
+		r.readToIndex -= numBytesParsed
+		if r.state >= until {
+			return nil
+		}
+
+		if r.readToIndex >= len(r.buf) {
+			newBuf := make([]byte, len(r.buf)*2)
+			copy(newBuf, r.buf)
+			r.buf = newBuf
+		}
+		numBytesRead, err := r.src.Read(r.buf[r.readToIndex:])
+		r.readToIndex += numBytesRead
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if numBytesRead > 0 {
+					continue
+				}
+				if r.state == requestStateParsingBody {
+					return parseError(ErrBodyTooShort, fmt.Sprintf("got %d bytes", r.bodyLengthRead))
+				}
+				return parseError(ErrIncomplete, fmt.Sprintf("%d bytes unparsed", r.readToIndex))
+			}
+			return err
 		}
+	}
+}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+// Clone returns a copy of r whose Headers and Body can be changed without
+// affecting r.
+func (r *Request) Clone() *Request {
+	c := *r
+	c.Headers = headers.NewHeaders()
+	for k, v := range r.Headers {
+		c.Headers[k] = v
 	}
-	return req, nil
+	c.Body = append([]byte(nil), r.Body...)
+	return &c
+}
+
+// Context returns the request's context. The server cancels it when the
+// client disconnects, the server shuts down or the request times out, so
+// long-running handlers should pass it on to anything that blocks.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext replaces the request's context, for middleware that wants to
+// add a deadline or values for the handlers after it.
+func (r *Request) SetContext(ctx context.Context) {
+	if ctx == nil {
+		panic("request: nil context")
+	}
+	r.ctx = ctx
+}
+
+// SetValue attaches val to the request's context under key so that
+// middleware can pass things like the current session down to handlers.
+// Use an unexported key type to avoid clashes between packages.
+func (r *Request) SetValue(key, val any) {
+	r.ctx = context.WithValue(r.Context(), key, val)
+}
+
+// Value returns the value attached under key, or nil.
+func (r *Request) Value(key any) any {
+	return r.Context().Value(key)
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -91,13 +298,13 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 func requestLineFromString(str string) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, parseError(ErrMalformedRequestLine, fmt.Sprintf("%q", str))
 	}
 
 	method := parts[0]
 	for _, c := range method {
 		if c < 'A' || c > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
+			return nil, parseError(ErrInvalidMethod, fmt.Sprintf("%q", method))
 		}
 	}
 
@@ -105,16 +312,19 @@ func requestLineFromString(str string) (*RequestLine, error) {
 
 	versionParts := strings.Split(parts[2], "/")
 	if len(versionParts) != 2 {
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+		return nil, parseError(ErrMalformedRequestLine, fmt.Sprintf("%q", str))
 	}
 
 	httpPart := versionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
+		return nil, parseError(ErrMalformedRequestLine, fmt.Sprintf("%q", str))
 	}
 	version := versionParts[1]
+	if len(version) != 3 || !isDigit(version[0]) || version[1] != '.' || !isDigit(version[2]) {
+		return nil, parseError(ErrMalformedRequestLine, fmt.Sprintf("%q", str))
+	}
 	if version != "1.1" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", version)
+		return nil, parseError(ErrUnsupportedVersion, version)
 	}
 
 	return &RequestLine{
@@ -124,9 +334,13 @@ func requestLineFromString(str string) (*RequestLine, error) {
 	}, nil
 }
 
-func (r *Request) parse(data []byte) (int, error) {
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (r *Request) parse(data []byte, until requestState) (int, error) {
 	totalBytesParsed := 0
-	for r.state != requestStateDone {
+	for r.state < until {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
@@ -157,27 +371,27 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case requestStateParsingHeaders:
 		n, done, err := r.Headers.Parse(data)
 		if err != nil {
-			return 0, err
+			return 0, parseError(ErrMalformedHeader, err.Error())
 		}
 		if done {
 			r.state = requestStateParsingBody
 		}
 		return n, nil
 	case requestStateParsingBody:
-		contentLenStr, ok := r.Headers.Get("Content-Length")
+		contentLen, ok, err := r.Headers.GetInt("Content-Length")
 		if !ok {
-			// assume that if no content-length header is present, there is no body
+			// assume that if no content-length header is present, there is
+			// no body; anything after it is left for Buffered
 			r.state = requestStateDone
-			return len(data), nil
+			return 0, nil
 		}
-		contentLen, err := strconv.Atoi(contentLenStr)
 		if err != nil {
-			return 0, fmt.Errorf("malformed Content-Length: %s", err)
+			return 0, parseError(ErrInvalidContentLength, err.Error())
 		}
 		r.Body = append(r.Body, data...)
-		r.bodyLengthRead += len(data)
+		r.bodyLengthRead += int64(len(data))
 		if r.bodyLengthRead > contentLen {
-			return 0, fmt.Errorf("Content-Length too large")
+			return 0, parseError(ErrBodyTooLong, fmt.Sprintf("got %d bytes, want %d", r.bodyLengthRead, contentLen))
 		}
 		if r.bodyLengthRead == contentLen {
 			r.state = requestStateDone
@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"io"
+	"context"
 
 )
 
@@ -73,6 +74,31 @@ func TestStandardBodyAndShorterThanReportedContentLength(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Equal(t, 0, len(r.Body))
+
+	// Test: Signed Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: +5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Repeated Content-Length
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
 }
 
 func TestRequestLineParse(t *testing.T) {
@@ -218,4 +244,139 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	cr.pos += n
 
 	return n, nil
-}
\ No newline at end of file
+}
+
+func TestHeadFromReader(t *testing.T) {
+	// Test: Body is left unread until ReadBody, which calls OnContinue once
+	reader := &chunkReader{
+		data: "PUT /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Expect: 100-Continue\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := HeadFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.ExpectsContinue())
+	assert.Equal(t, 0, len(r.Body))
+	assert.Less(t, reader.pos, len(reader.data))
+	continued := 0
+	r.OnContinue(func() { continued++ })
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, 1, continued)
+
+	// Test: No 100 Continue for an empty body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Expect: 100-continue\r\n" +
+			"Content-Length: 0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = HeadFromReader(reader)
+	require.NoError(t, err)
+	r.OnContinue(func() { continued++ })
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, 1, continued)
+
+	// Test: Requests built by hand keep their Body
+	r = &Request{Body: []byte("as is")}
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "as is", string(body))
+	assert.False(t, r.ExpectsContinue())
+
+	// Test: Bytes past a request without a body are kept
+	reader = &chunkReader{
+		data: "GET /chat HTTP/1.1\r\n" +
+			"Upgrade: echo\r\n" +
+			"\r\n" +
+			"early bytes",
+		numBytesPerRead: 64,
+	}
+	r, err = HeadFromReader(reader)
+	require.NoError(t, err)
+	assert.Nil(t, r.Buffered())
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	assert.Equal(t, "early bytes", string(r.Buffered()))
+}
+
+func TestContext(t *testing.T) {
+	// Test: Requests start with a background context
+	r := &Request{}
+	assert.Equal(t, context.Background(), r.Context())
+
+	// Test: Values are kept on the context and survive SetContext children
+	type key struct{}
+	r.SetValue(key{}, "v")
+	assert.Equal(t, "v", r.Value(key{}))
+	ctx, cancel := context.WithCancel(r.Context())
+	r.SetContext(ctx)
+	assert.Equal(t, "v", r.Value(key{}))
+	assert.Equal(t, "v", r.Clone().Value(key{}))
+	cancel()
+	assert.ErrorIs(t, r.Context().Err(), context.Canceled)
+
+	// Test: OnBodyRead runs once after the whole body is in
+	reader := &chunkReader{
+		data: "POST / HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 4,
+	}
+	r, err := HeadFromReader(reader)
+	require.NoError(t, err)
+	read := 0
+	r.OnBodyRead(func() {
+		read++
+		assert.Equal(t, "hello", string(r.Body))
+	})
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, 1, read)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		err    error
+		status int
+	}{
+		{"Too few parts", "/coffee HTTP/1.1\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"Lower-case method", "get / HTTP/1.1\r\n\r\n", ErrInvalidMethod, 400},
+		{"Not HTTP", "GET / TCP/1.1\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"Garbled version", "GET / HTTP/one\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"Other version", "GET / HTTP/1.0\r\n\r\n", ErrUnsupportedVersion, 505},
+		{"Bad header", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", ErrMalformedHeader, 400},
+		{"Bad Content-Length", "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", ErrInvalidContentLength, 400},
+		{"Body too long", "POST / HTTP/1.1\r\nContent-Length: 2\r\n\r\nabc", ErrBodyTooLong, 400},
+		{"Body too short", "POST / HTTP/1.1\r\nContent-Length: 20\r\n\r\nabc", ErrBodyTooShort, 400},
+		{"Head cut off", "GET / HTTP/1.1\r\nHost: x", ErrIncomplete, 400},
+		{"Nothing sent", "", ErrIncomplete, 400},
+	} {
+		// Test: Each failure has its own error and status
+		_, err := RequestFromReader(&chunkReader{data: tc.data, numBytesPerRead: len(tc.data)})
+		require.ErrorIs(t, err, tc.err, tc.name)
+		var pe *ParseError
+		require.ErrorAs(t, err, &pe, tc.name)
+		assert.Equal(t, tc.status, pe.StatusCode(), tc.name)
+	}
+
+	// Test: The message says what was wrong with the request
+	_, err := RequestFromReader(&chunkReader{data: "GET / HTTP/1.1 extra\r\n\r\n", numBytesPerRead: 4})
+	assert.EqualError(t, err, `malformed request line: "GET / HTTP/1.1 extra"`)
+}
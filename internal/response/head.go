@@ -0,0 +1,32 @@
+package response
+
+import "HTTPFTCP/internal/headers"
+
+// headSink passes the status line and headers through but drops the body,
+// so a GET handler can answer a HEAD request with the same headers.
+type headSink struct {
+	*Writer
+}
+
+// DiscardBody returns a Writer that forwards the status line and headers to
+// w, including any Content-Length or Transfer-Encoding the handler
+// computed, and silently discards the body and trailers.
+func DiscardBody(w *Writer) *Writer {
+	return NewSinkWriter(headSink{w})
+}
+
+func (headSink) WriteBody(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (headSink) WriteChunkedBody(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (headSink) WriteChunkedBodyDone() (int, error) {
+	return 0, nil
+}
+
+func (headSink) WriteTrailers(headers.Headers) error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package response
+
+import (
+	"bytes"
+
+	"HTTPFTCP/internal/headers"
+)
+
+// Recorder is a Sink that keeps a response in memory so middleware can
+// inspect it before deciding what to send.
+type Recorder struct {
+	// Informational holds any 1xx interim responses, in order.
+	Informational []Interim
+
+	StatusCode  StatusCode
+	Reason      string
+	Headers     headers.Headers
+	HeaderLines []HeaderLine
+	Body        bytes.Buffer
+	Chunked     bool
+	Trailers    headers.Headers
+}
+
+// Interim is a recorded 1xx response.
+type Interim struct {
+	StatusCode StatusCode
+	Headers    headers.Headers
+}
+
+// NewRecorder returns an empty Recorder and a Writer that records into it.
+func NewRecorder() (*Recorder, *Writer) {
+	r := &Recorder{}
+	return r, NewSinkWriter(r)
+}
+
+func (r *Recorder) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+	copied := headers.NewHeaders()
+	for k, v := range h {
+		copied[k] = v
+	}
+	r.Informational = append(r.Informational, Interim{StatusCode: statusCode, Headers: copied})
+	return nil
+}
+
+func (r *Recorder) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
+	r.StatusCode = statusCode
+	r.Reason = reason
+	return nil
+}
+
+func (r *Recorder) AddHeaderLine(key, value string) error {
+	r.HeaderLines = append(r.HeaderLines, HeaderLine{Key: key, Value: value})
+	return nil
+}
+
+func (r *Recorder) WriteHeaders(h headers.Headers) error {
+	r.Headers = headers.NewHeaders()
+	for k, v := range h {
+		r.Headers.Override(k, v)
+	}
+	return nil
+}
+
+func (r *Recorder) WriteBody(p []byte) (int, error) {
+	return r.Body.Write(p)
+}
+
+func (r *Recorder) WriteChunkedBody(p []byte) (int, error) {
+	r.Chunked = true
+	return r.Body.Write(p)
+}
+
+func (r *Recorder) WriteChunkedBodyDone() (int, error) {
+	r.Chunked = true
+	return 0, nil
+}
+
+func (r *Recorder) WriteTrailers(h headers.Headers) error {
+	r.Trailers = headers.NewHeaders()
+	for k, v := range h {
+		r.Trailers[k] = v
+	}
+	return nil
+}
+
+// ReplayInformational writes the recorded 1xx responses to w, for
+// middleware that sends a final response of its own in place of the
+// recorded one.
+func (r *Recorder) ReplayInformational(w *Writer) error {
+	for _, i := range r.Informational {
+		if err := w.WriteInformational(i.StatusCode, i.Headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay writes the recorded response to w. A chunked body is sent as a
+// single chunk followed by the recorded trailers.
+func (r *Recorder) Replay(w *Writer) error {
+	if err := r.ReplayInformational(w); err != nil {
+		return err
+	}
+	if err := w.WriteStatusLineWithReason(r.StatusCode, r.Reason); err != nil {
+		return err
+	}
+	for _, l := range r.HeaderLines {
+		if err := w.AddHeaderLine(l.Key, l.Value); err != nil {
+			return err
+		}
+	}
+	h := headers.NewHeaders()
+	for k, v := range r.Headers {
+		h[k] = v
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	if !r.Chunked {
+		if r.Body.Len() == 0 {
+			return nil
+		}
+		_, err := w.WriteBody(r.Body.Bytes())
+		return err
+	}
+	if r.Body.Len() > 0 {
+		if _, err := w.WriteChunkedBody(r.Body.Bytes()); err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	trailers := r.Trailers
+	if trailers == nil {
+		trailers = headers.NewHeaders()
+	}
+	return w.WriteTrailers(trailers)
+}
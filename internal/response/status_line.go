@@ -8,21 +8,74 @@ import (
 type StatusCode int
 
 const (
-	StatusCodeSuccess             StatusCode = 200
-	StatusCodeBadRequest          StatusCode = 400
-	StatusCodeInternalServerError StatusCode = 500
+	StatusCodeContinue             StatusCode = 100
+	StatusCodeEarlyHints           StatusCode = 103
+	StatusCodeSuccess              StatusCode = 200
+	StatusCodeCreated              StatusCode = 201
+	StatusCodeNoContent            StatusCode = 204
+	StatusCodePartialContent       StatusCode = 206
+	StatusCodeMovedPermanently     StatusCode = 301
+	StatusCodeFound                StatusCode = 302
+	StatusCodeNotModified          StatusCode = 304
+	StatusCodeBadRequest           StatusCode = 400
+	StatusCodeUnauthorized         StatusCode = 401
+	StatusCodeForbidden            StatusCode = 403
+	StatusCodeNotFound             StatusCode = 404
+	StatusCodeMethodNotAllowed     StatusCode = 405
+	StatusCodeNotAcceptable        StatusCode = 406
+	StatusCodePreconditionFailed   StatusCode = 412
+	StatusCodeContentTooLarge      StatusCode = 413
+	StatusCodeUnsupportedMediaType StatusCode = 415
+	StatusCodeRangeNotSatisfiable  StatusCode = 416
+	StatusCodeExpectationFailed    StatusCode = 417
+	StatusCodeTooManyRequests      StatusCode = 429
+	StatusCodeInternalServerError  StatusCode = 500
+	StatusCodeBadGateway           StatusCode = 502
+	StatusCodeServiceUnavailable   StatusCode = 503
+	StatusCodeGatewayTimeout       StatusCode = 504
+	StatusCodeVersionNotSupported  StatusCode = 505
 )
 
+var statusText = map[StatusCode]string{
+	StatusCodeContinue:             "Continue",
+	StatusCodeEarlyHints:           "Early Hints",
+	StatusCodeSuccess:              "OK",
+	StatusCodeCreated:              "Created",
+	StatusCodeNoContent:            "No Content",
+	StatusCodePartialContent:       "Partial Content",
+	StatusCodeMovedPermanently:     "Moved Permanently",
+	StatusCodeFound:                "Found",
+	StatusCodeNotModified:          "Not Modified",
+	StatusCodeBadRequest:           "Bad Request",
+	StatusCodeUnauthorized:         "Unauthorized",
+	StatusCodeForbidden:            "Forbidden",
+	StatusCodeNotFound:             "Not Found",
+	StatusCodeMethodNotAllowed:     "Method Not Allowed",
+	StatusCodeNotAcceptable:        "Not Acceptable",
+	StatusCodePreconditionFailed:   "Precondition Failed",
+	StatusCodeContentTooLarge:      "Content Too Large",
+	StatusCodeUnsupportedMediaType: "Unsupported Media Type",
+	StatusCodeRangeNotSatisfiable:  "Range Not Satisfiable",
+	StatusCodeExpectationFailed:    "Expectation Failed",
+	StatusCodeTooManyRequests:      "Too Many Requests",
+	StatusCodeInternalServerError:  "Internal Server Error",
+	StatusCodeBadGateway:           "Bad Gateway",
+	StatusCodeServiceUnavailable:   "Service Unavailable",
+	StatusCodeGatewayTimeout:       "Gateway Timeout",
+	StatusCodeVersionNotSupported:  "HTTP Version Not Supported",
+}
+
+// StatusText returns the standard reason phrase for statusCode, or an empty
+// string if it is not one we know.
+func StatusText(statusCode StatusCode) string {
+	return statusText[statusCode]
+}
+
 func getStatusLine(statusCode StatusCode) []byte {
-	reasonPhrase := ""
-	switch statusCode {
-	case StatusCodeSuccess:
-		reasonPhrase = "OK"
-	case StatusCodeBadRequest:
-		reasonPhrase = "Bad Request"
-	case StatusCodeInternalServerError:
-		reasonPhrase = "Internal Server Error"
-	}
+	return statusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+func statusLineWithReason(statusCode StatusCode, reasonPhrase string) []byte {
 	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reasonPhrase))
 }
 
@@ -0,0 +1,143 @@
+package response
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"HTTPFTCP/internal/headers"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Digest selects a hash that a TrailerWriter computes over the body.
+type Digest int
+
+const (
+	DigestSHA256 Digest = iota
+	DigestSHA512
+	DigestBLAKE2b
+	DigestCRC32C
+)
+
+// trailerName is the trailer field each digest is reported in.
+func (d Digest) trailerName() string {
+	switch d {
+	case DigestSHA256:
+		return "X-Content-SHA256"
+	case DigestSHA512:
+		return "X-Content-SHA512"
+	case DigestBLAKE2b:
+		return "X-Content-BLAKE2b"
+	case DigestCRC32C:
+		return "X-Content-CRC32C"
+	}
+	return ""
+}
+
+func (d Digest) newHash() (hash.Hash, error) {
+	switch d {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestBLAKE2b:
+		return blake2b.New256(nil)
+	case DigestCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+	return nil, fmt.Errorf("unknown digest: %d", d)
+}
+
+const contentLengthTrailer = "X-Content-Length"
+
+// TrailerWriter writes a chunked body through a Writer while hashing it
+// incrementally, so the digests and length can be sent as trailers without
+// holding the body in memory.
+type TrailerWriter struct {
+	w       *Writer
+	digests []Digest
+	hashes  []hash.Hash
+	length  int
+	closed  bool
+}
+
+// NewTrailerWriter wraps w. With no digests given only SHA-256 is computed.
+// X-Content-Length is always reported.
+func NewTrailerWriter(w *Writer, digests ...Digest) (*TrailerWriter, error) {
+	if len(digests) == 0 {
+		digests = []Digest{DigestSHA256}
+	}
+	tw := &TrailerWriter{w: w, digests: digests}
+	for _, d := range digests {
+		h, err := d.newHash()
+		if err != nil {
+			return nil, err
+		}
+		tw.hashes = append(tw.hashes, h)
+	}
+	return tw, nil
+}
+
+// TrailerNames is the value for the Trailer header announcing the fields
+// Close will send.
+func (t *TrailerWriter) TrailerNames() string {
+	names := make([]string, 0, len(t.digests)+1)
+	for _, d := range t.digests {
+		names = append(names, d.trailerName())
+	}
+	names = append(names, contentLengthTrailer)
+	return strings.Join(names, ", ")
+}
+
+// DeclareTrailers sets up h for a chunked body carrying this writer's
+// trailers. Call it before WriteHeaders.
+func (t *TrailerWriter) DeclareTrailers(h headers.Headers) {
+	delete(h, "content-length")
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Trailer", t.TrailerNames())
+}
+
+// Write sends p as one chunk and feeds it to every digest.
+func (t *TrailerWriter) Write(p []byte) (int, error) {
+	if t.closed {
+		return 0, fmt.Errorf("write after close")
+	}
+	if len(p) == 0 {
+		// a zero-length chunk would end the body early
+		return 0, nil
+	}
+	n, err := t.w.WriteChunkedBody(p)
+	for _, h := range t.hashes {
+		h.Write(p[:n])
+	}
+	t.length += n
+	return n, err
+}
+
+// Trailers returns the trailer fields for everything written so far.
+func (t *TrailerWriter) Trailers() headers.Headers {
+	trailers := headers.Headers{}
+	for i, d := range t.digests {
+		trailers[d.trailerName()] = hex.EncodeToString(t.hashes[i].Sum(nil))
+	}
+	trailers[contentLengthTrailer] = strconv.Itoa(t.length)
+	return trailers
+}
+
+// Close finishes the chunked body and writes the declared trailers.
+func (t *TrailerWriter) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	if _, err := t.w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return t.w.WriteTrailers(t.Trailers())
+}
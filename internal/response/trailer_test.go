@@ -0,0 +1,45 @@
+package response
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrailerWriter(t *testing.T) {
+	// Test: Chunks are framed and trailers match the whole body
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	tw, err := NewTrailerWriter(w, DigestSHA256, DigestCRC32C)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h := GetDefaultHeaders(0)
+	tw.DeclareTrailers(h)
+	assert.Equal(t, "X-Content-SHA256, X-Content-CRC32C, X-Content-Length", h["trailer"])
+	_, ok := h.Get("Content-Length")
+	assert.False(t, ok)
+	require.NoError(t, w.WriteHeaders(h))
+
+	_, err = tw.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = tw.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	sum := sha256.Sum256([]byte("hello world"))
+	out := buf.String()
+	assert.Contains(t, out, "6\r\nhello \r\n5\r\nworld\r\n0\r\n")
+	assert.Contains(t, out, "X-Content-SHA256: "+hex.EncodeToString(sum[:])+"\r\n")
+	assert.Contains(t, out, "X-Content-Length: 11\r\n")
+	assert.Contains(t, out, "X-Content-CRC32C: c99465aa\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: Writing after close fails
+	_, err = tw.Write([]byte("late"))
+	require.Error(t, err)
+}
@@ -3,6 +3,7 @@ package response
 import (
 	"io"
 	"fmt"
+	"strings"
 	"HTTPFTCP/internal/headers"
 )
 
@@ -14,38 +15,191 @@ const (
 	writerStateBody
 )
 
+// Sink receives each part of a response once a Writer has checked that it
+// arrived in order. *Writer is itself a Sink, so middleware can slip its own
+// Sink in between a handler and the connection with NewSinkWriter.
+type Sink interface {
+    WriteInformational(statusCode StatusCode, h headers.Headers) error
+    WriteStatusLineWithReason(statusCode StatusCode, reason string) error
+    AddHeaderLine(key, value string) error
+    WriteHeaders(h headers.Headers) error
+    WriteBody(p []byte) (int, error)
+    WriteChunkedBody(p []byte) (int, error)
+    WriteChunkedBodyDone() (int, error)
+    WriteTrailers(h headers.Headers) error
+}
+
 type Writer struct {
     writerState writerState
     writer      io.Writer
+    counter     *byteCounter
+    next        Sink
+    headerLines []HeaderLine
+    status      StatusCode
+}
+
+// byteCounter counts what a Writer sends down the connection.
+type byteCounter struct {
+    w io.Writer
+    n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+    n, err := c.w.Write(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// HeaderLine is a field that is written on its own line rather than being
+// folded into headers.Headers.
+type HeaderLine struct {
+    Key   string
+    Value string
 }
 
 func NewWriter(w io.Writer) *Writer {
+    counter := &byteCounter{w: w}
     return &Writer{
         writerState: writerStateStatusLine,
-        writer:      w,
+        writer:      counter,
+        counter:     counter,
+    }
+}
+
+// NewSinkWriter returns a Writer that hands every part of the response to
+// next instead of serializing it.
+func NewSinkWriter(next Sink) *Writer {
+    return &Writer{
+        writerState: writerStateStatusLine,
+        next:        next,
+    }
+}
+
+// WriteInformational sends a 1xx interim response, such as 103 Early Hints,
+// ahead of the final one. It can be called any number of times before
+// WriteStatusLine.
+func (w *Writer) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+    if w.writerState != writerStateStatusLine {
+        return fmt.Errorf("cannot write informational response in state %d", w.writerState)
+    }
+    // 101 Switching Protocols ends the HTTP/1.1 exchange, so it isn't interim
+    if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+        return fmt.Errorf("invalid informational status code: %d", statusCode)
+    }
+    for k, v := range h {
+        if strings.ContainsAny(k, "\r\n: ") || strings.ContainsAny(v, "\r\n") {
+            return fmt.Errorf("invalid header: %q: %q", k, v)
+        }
     }
+    if w.next != nil {
+        return w.next.WriteInformational(statusCode, h)
+    }
+    if _, err := w.writer.Write(getStatusLine(statusCode)); err != nil {
+        return err
+    }
+    return WriteHeaders(w.writer, h)
+}
+
+// WriteEarlyHints sends 103 Early Hints with links, such as
+// `</style.css>; rel=preload; as=style`, joined into one Link field.
+func (w *Writer) WriteEarlyHints(links ...string) error {
+    h := headers.NewHeaders()
+    for _, l := range links {
+        h.Set("Link", l)
+    }
+    return w.WriteInformational(StatusCodeEarlyHints, h)
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+    return w.WriteStatusLineWithReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineWithReason is WriteStatusLine with a caller-supplied reason
+// phrase, for relaying a status we didn't produce ourselves.
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
     if w.writerState != writerStateStatusLine {
         return fmt.Errorf("cannot write status line in state %d", w.writerState)
     }
+    if statusCode < 100 || statusCode > 999 {
+        return fmt.Errorf("invalid status code: %d", statusCode)
+    }
+    if strings.ContainsAny(reason, "\r\n") {
+        return fmt.Errorf("invalid reason phrase: %q", reason)
+    }
     defer func() { w.writerState = writerStateHeaders }()
-    _, err := w.writer.Write(getStatusLine(statusCode))
+    w.status = statusCode
+    if w.next != nil {
+        return w.next.WriteStatusLineWithReason(statusCode, reason)
+    }
+    _, err := w.writer.Write(statusLineWithReason(statusCode, reason))
     return err
 }
 
+// Status returns the status code written so far, or 0 before
+// WriteStatusLine.
+func (w *Writer) Status() StatusCode {
+    return w.status
+}
+
+// BytesWritten returns how many bytes of the response, head and framing
+// included, have gone to the underlying io.Writer. It is 0 for a Writer
+// made by NewSinkWriter, which hands everything on instead.
+func (w *Writer) BytesWritten() int64 {
+    if w.counter == nil {
+        return 0
+    }
+    return w.counter.n
+}
+
+// AddHeaderLine queues a field for the next WriteHeaders call that is written
+// on its own line, for fields like Set-Cookie that can't be comma-joined.
+func (w *Writer) AddHeaderLine(key, value string) error {
+    if w.writerState == writerStateBody {
+        return fmt.Errorf("cannot add header in state %d", w.writerState)
+    }
+    if strings.ContainsAny(key, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+        return fmt.Errorf("invalid header line: %q: %q", key, value)
+    }
+    w.headerLines = append(w.headerLines, HeaderLine{Key: key, Value: value})
+    return nil
+}
+
+// SetCookie queues a Set-Cookie line for c. Like AddHeaderLine it must be
+// called before WriteHeaders.
+func (w *Writer) SetCookie(c *headers.Cookie) error {
+    if err := c.Valid(); err != nil {
+        return err
+    }
+    return w.AddHeaderLine("Set-Cookie", c.String())
+}
+
 func (w *Writer) WriteHeaders(h headers.Headers) error {
     if w.writerState != writerStateHeaders {
         return fmt.Errorf("cannot write headers in state %d", w.writerState)
     }
     defer func() { w.writerState = writerStateBody }()
+    lines := w.headerLines
+    w.headerLines = nil
+    if w.next != nil {
+        for _, l := range lines {
+            if err := w.next.AddHeaderLine(l.Key, l.Value); err != nil {
+                return err
+            }
+        }
+        return w.next.WriteHeaders(h)
+    }
     for k, v := range h {
         _, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
         if err != nil {
             return err
         }
     }
+    for _, l := range lines {
+        _, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", l.Key, l.Value)))
+        if err != nil {
+            return err
+        }
+    }
     _, err := w.writer.Write([]byte("\r\n"))
     return err
 }
@@ -54,10 +208,19 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
     if w.writerState != writerStateBody {
         return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
     }
+    if w.next != nil {
+        return w.next.WriteBody(p)
+    }
     return w.writer.Write(p)
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+    if w.writerState != writerStateBody {
+        return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
+    }
+    if w.next != nil {
+        return w.next.WriteChunkedBody(p)
+    }
     hexSize := fmt.Sprintf("%x", len(p))
     if _, err := w.writer.Write([]byte(hexSize + "\r\n")); err != nil {
         return 0, err
@@ -76,6 +239,9 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
     if w.writerState != writerStateBody {
         return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
     }
+    if w.next != nil {
+        return w.next.WriteChunkedBodyDone()
+    }
     n, err := w.writer.Write([]byte("0\r\n"))
     if err != nil {
         return n, err
@@ -88,6 +254,9 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
     if w.writerState != writerStateBody {
         return fmt.Errorf("cannot write trailers in state %d", w.writerState)
     }
+    if w.next != nil {
+        return w.next.WriteTrailers(h)
+    }
 
     for k, v := range h {
         _, err := w.writer.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
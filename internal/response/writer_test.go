@@ -0,0 +1,65 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Interim responses go out ahead of the final one
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteInformational(StatusCodeContinue, nil))
+	require.NoError(t, w.WriteEarlyHints("</style.css>; rel=preload; as=style"))
+	require.NoError(t, w.WriteStatusLine(StatusCodeNoContent))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nlink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+
+	// Test: Not after the final status line, and never 101 or a final code
+	assert.Error(t, w.WriteInformational(StatusCodeEarlyHints, nil))
+	w = NewWriter(&buf)
+	assert.Error(t, w.WriteInformational(101, nil))
+	assert.Error(t, w.WriteInformational(StatusCodeSuccess, nil))
+	assert.Error(t, w.WriteInformational(StatusCodeEarlyHints, headers.Headers{"link": "a\r\nb"}))
+
+	// Test: Recorder keeps interim responses and replays them in order
+	rec, rw := NewRecorder()
+	require.NoError(t, rw.WriteEarlyHints("</a.js>; rel=preload", "</b.css>; rel=preload"))
+	require.NoError(t, rw.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, rw.WriteHeaders(GetDefaultHeaders(0)))
+	require.Len(t, rec.Informational, 1)
+	assert.Equal(t, "</a.js>; rel=preload, </b.css>; rel=preload", rec.Informational[0].Headers["link"])
+	buf.Reset()
+	require.NoError(t, rec.Replay(NewWriter(&buf)))
+	assert.Contains(t, buf.String(), "HTTP/1.1 103 Early Hints\r\n")
+	assert.Less(t, bytes.Index(buf.Bytes(), []byte("103")), bytes.Index(buf.Bytes(), []byte("200")))
+}
+
+func TestWriterCounts(t *testing.T) {
+	// Test: The status and every byte sent are tracked
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.Equal(t, StatusCode(0), w.Status())
+	require.NoError(t, w.WriteStatusLine(StatusCodeNotFound))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked"}))
+	_, err := w.WriteChunkedBody([]byte("hi"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(nil))
+	assert.Equal(t, StatusCodeNotFound, w.Status())
+	assert.Equal(t, int64(buf.Len()), w.BytesWritten())
+
+	// Test: Sink writers know the status but send nothing themselves
+	_, sw := NewRecorder()
+	require.NoError(t, sw.WriteStatusLine(StatusCodeSuccess))
+	assert.Equal(t, StatusCodeSuccess, sw.Status())
+	assert.Equal(t, int64(0), sw.BytesWritten())
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"time"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+type connJSON struct {
+	ID         uint64    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	State      string    `json:"state"`
+	Requests   int64     `json:"requests"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Created    time.Time `json:"created"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// ConnsHandler is an admin endpoint for the connections of the server
+// handling the request. GET lists them as JSON and DELETE closes the one
+// whose ID ends the path, as in DELETE /admin/conns/42. Anyone who can
+// reach it can cut off other clients, so mount it where only operators
+// can.
+func ConnsHandler(w *response.Writer, req *request.Request) {
+	s := ServerFromRequest(req)
+	if s == nil {
+		writeError(w, response.StatusCodeInternalServerError, "No server\n")
+		return
+	}
+	if req.RequestLine.Method == "DELETE" {
+		id, err := strconv.ParseUint(path.Base(req.Path()), 10, 64)
+		switch {
+		case err != nil:
+			writeError(w, response.StatusCodeBadRequest, "Bad connection ID\n")
+		case !s.CloseConn(id):
+			writeError(w, response.StatusCodeNotFound, "No such connection\n")
+		default:
+			w.WriteStatusLine(response.StatusCodeNoContent)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+		}
+		return
+	}
+
+	now := time.Now()
+	conns := []connJSON{}
+	for _, c := range s.Conns() {
+		conns = append(conns, connJSON{
+			ID:         c.ID,
+			RemoteAddr: c.RemoteAddr,
+			State:      c.State.String(),
+			Requests:   c.Requests,
+			BytesIn:    c.BytesIn,
+			BytesOut:   c.BytesOut,
+			Created:    c.Created,
+			AgeSeconds: now.Sub(c.Created).Seconds(),
+		})
+	}
+	body, _ := json.Marshal(conns)
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "application/json")
+	h.Override("Cache-Control", "no-store")
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
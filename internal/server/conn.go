@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"HTTPFTCP/internal/request"
+)
+
+// ConnState is a stage in a connection's life, as reported to
+// Options.ConnState.
+type ConnState int
+
+const (
+	// StateNew is a connection that has just been accepted and has not
+	// sent anything yet.
+	StateNew ConnState = iota
+	// StateActive is a connection that has sent some of a request and is
+	// being served.
+	StateActive
+	// StateIdle is a connection that has been served and is waiting for
+	// its next request. Connections here carry one request each and close
+	// after it, so they don't pass through it yet.
+	StateIdle
+	// StateHijacked is a connection a handler has taken over with Hijack.
+	// It is the last state the server reports for it.
+	StateHijacked
+	// StateClosed is a connection that has been closed.
+	StateClosed
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateHijacked:
+		return "hijacked"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ConnInfo describes a connection being served.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr string
+	State      ConnState
+	Requests   int64
+	BytesIn    int64
+	BytesOut   int64
+	Created    time.Time
+}
+
+// conn is the server's side of one connection. It counts what passes
+// through it and reports its state changes.
+type conn struct {
+	net.Conn
+	id      uint64
+	server  *Server
+	created time.Time
+
+	requests atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	mu       sync.Mutex
+	state    ConnState
+	hijacked bool
+	watching chan struct{}           // closed when watchClose returns, if it was started
+	pending  []byte                  // read by watchClose after a hijack
+	cancel   context.CancelCauseFunc // of the request, for failed writes
+}
+
+var ErrHijacked = errors.New("server: connection already hijacked")
+
+// track starts following raw as a connection being served.
+func (s *Server) track(raw net.Conn) *conn {
+	c := &conn{Conn: raw, server: s, created: time.Now()}
+	s.mu.Lock()
+	s.nextConnID++
+	c.id = s.nextConnID
+	if s.conns == nil {
+		s.conns = map[uint64]*conn{}
+	}
+	s.conns[c.id] = c
+	s.mu.Unlock()
+	c.setState(StateNew)
+	return c
+}
+
+func (s *Server) untrack(c *conn) {
+	s.mu.Lock()
+	delete(s.conns, c.id)
+	s.mu.Unlock()
+}
+
+// setState records st and tells Options.ConnState about it.
+func (c *conn) setState(st ConnState) {
+	c.mu.Lock()
+	c.state = st
+	c.mu.Unlock()
+	if c.server.opts.ConnState != nil {
+		c.server.opts.ConnState(c.Conn, st)
+	}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.bytesIn.Add(int64(n))
+	if n > 0 {
+		c.mu.Lock()
+		first := c.state == StateNew || c.state == StateIdle
+		c.mu.Unlock()
+		if first {
+			c.setState(StateActive)
+		}
+	}
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(int64(n))
+	if err != nil {
+		c.mu.Lock()
+		cancel := c.cancel
+		hijacked := c.hijacked
+		c.mu.Unlock()
+		if cancel != nil && !hijacked {
+			cancel(ErrClientDisconnected)
+		}
+	}
+	return n, err
+}
+
+// close closes the connection once it has been served, unless a handler
+// has hijacked it.
+func (c *conn) close() {
+	c.server.untrack(c)
+	c.mu.Lock()
+	hijacked := c.hijacked
+	c.mu.Unlock()
+	if hijacked {
+		return
+	}
+	c.Conn.Close()
+	c.setState(StateClosed)
+}
+
+func (c *conn) info() ConnInfo {
+	c.mu.Lock()
+	state := c.state
+	c.mu.Unlock()
+	return ConnInfo{
+		ID:         c.id,
+		RemoteAddr: c.RemoteAddr().String(),
+		State:      state,
+		Requests:   c.requests.Load(),
+		BytesIn:    c.bytesIn.Load(),
+		BytesOut:   c.bytesOut.Load(),
+		Created:    c.created,
+	}
+}
+
+// Conns lists the connections being served, oldest first. Hijacked
+// connections are no longer the server's and aren't included.
+func (s *Server) Conns() []ConnInfo {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	infos := make([]ConnInfo, len(conns))
+	for i, c := range conns {
+		infos[i] = c.info()
+	}
+	slices.SortFunc(infos, func(a, b ConnInfo) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return infos
+}
+
+// CloseConn closes the connection with the given ID. Its request's context
+// is cancelled with ErrClientDisconnected, whether or not the body has
+// been read. It reports whether there was such a connection.
+func (s *Server) CloseConn(id uint64) bool {
+	s.mu.Lock()
+	c, ok := s.conns[id]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+	c.Conn.Close()
+	if cancel != nil {
+		cancel(ErrClientDisconnected)
+	}
+	return true
+}
+
+type connKey struct{}
+
+func connFromRequest(req *request.Request) *conn {
+	c, _ := req.Value(connKey{}).(*conn)
+	return c
+}
+
+// ServerFromRequest returns the Server that is handling req, or nil.
+func ServerFromRequest(req *request.Request) *Server {
+	if c := connFromRequest(req); c != nil {
+		return c.server
+	}
+	return nil
+}
+
+// Hijack hands req's connection over to the caller, for protocols that
+// take over from HTTP, such as after a 101 Switching Protocols the caller
+// writes itself. The server no longer reads, writes or closes it, and the
+// handler must not use its Writer afterwards. Anything the client sent
+// after the request is read from the returned conn first. Hijack only
+// works on requests the server is handling, once their body has been read.
+func Hijack(req *request.Request) (net.Conn, error) {
+	c := connFromRequest(req)
+	if c == nil {
+		return nil, errors.New("server: request has no connection")
+	}
+	c.mu.Lock()
+	if c.hijacked {
+		c.mu.Unlock()
+		return nil, ErrHijacked
+	}
+	c.hijacked = true
+	watching := c.watching
+	c.mu.Unlock()
+
+	if watching != nil {
+		// stop watchClose reading, keeping anything it read for the caller
+		c.Conn.SetReadDeadline(time.Now())
+		<-watching
+		c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.server.untrack(c)
+	c.setState(StateHijacked)
+	// the parser may have read past the request before watchClose started
+	pending := append(slices.Clone(req.Buffered()), c.pending...)
+	if len(pending) > 0 {
+		return &prefixConn{Conn: c.Conn, r: io.MultiReader(bytes.NewReader(pending), c.Conn)}, nil
+	}
+	return c.Conn, nil
+}
+
+// prefixConn is a net.Conn that reads some bytes already read from it
+// first.
+type prefixConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (p *prefixConn) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
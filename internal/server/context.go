@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Causes of a request's context being cancelled, as returned by
+// context.Cause.
+var (
+	ErrClientDisconnected = errors.New("server: client disconnected")
+	ErrServerClosed       = errors.New("server: closed")
+	ErrRequestTimeout     = errors.New("server: request timed out")
+)
+
+// requestContext makes the context for one request: a child of the
+// server's, with the request timeout if there is one.
+func (s *Server) requestContext() (context.Context, context.CancelCauseFunc) {
+	parent := s.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	if s.opts.RequestTimeout <= 0 {
+		return ctx, cancel
+	}
+	ctx, stop := context.WithTimeoutCause(ctx, s.opts.RequestTimeout, ErrRequestTimeout)
+	return ctx, func(cause error) {
+		cancel(cause)
+		stop()
+	}
+}
+
+// serving records the cancel function of the request being served, so
+// that a failed write to the client cancels it.
+func (c *conn) serving(cancel context.CancelCauseFunc) {
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+}
+
+// watch starts watchClose, unless the connection has been hijacked.
+func (c *conn) watch(cancel context.CancelCauseFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hijacked {
+		return
+	}
+	c.watching = make(chan struct{})
+	go c.watchClose(cancel)
+}
+
+// watchClose cancels the request once the connection is reset or closed
+// under it. A clean EOF only means the client has finished sending, as
+// after shutdown(SHUT_WR), and it may still be waiting for the response;
+// a client that has really gone is caught when writing to it fails. It
+// starts after the request has been read, so anything more the client
+// sends is discarded; each connection carries one request. If a handler
+// hijacks the connection, Hijack stops it and gets what it read since.
+func (c *conn) watchClose(cancel context.CancelCauseFunc) {
+	defer close(c.watching)
+	buf := make([]byte, 512)
+	for {
+		n, err := c.Read(buf)
+		c.mu.Lock()
+		hijacked := c.hijacked
+		if hijacked {
+			c.pending = append(c.pending, buf[:n]...)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			if !hijacked && !errors.Is(err, io.EOF) {
+				cancel(ErrClientDisconnected)
+			}
+			return
+		}
+	}
+}
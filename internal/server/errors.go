@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+// ErrorHandler writes the response to a request the server turns down
+// itself: one it couldn't parse, one with an Expect it can't meet, one
+// whose handler panicked before responding, or one on a connection over
+// the limits. Middleware can hand it theirs too, through ServeError. req
+// is nil if the request couldn't be parsed at all, or wasn't read. err
+// says what went wrong; it may quote the client's input, so it is meant
+// for logs rather than for the page.
+type ErrorHandler func(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error)
+
+// DefaultErrorHandler is the ErrorHandler used when Options.ErrorHandler
+// is nil. It sends the status text as plain text, followed for parse
+// errors by what kind of error it was, without echoing the request.
+func DefaultErrorHandler(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+	msg := response.StatusText(statusCode)
+	var pe *request.ParseError
+	if errors.As(err, &pe) {
+		msg += ": " + pe.Err.Error()
+	}
+	writeError(w, statusCode, msg+"\n")
+}
+
+// ParseErrorStatus is the status to answer a request that failed to parse
+// with err, or 400 if err isn't a request.ParseError.
+func ParseErrorStatus(err error) response.StatusCode {
+	var pe *request.ParseError
+	if errors.As(err, &pe) {
+		return response.StatusCode(pe.StatusCode())
+	}
+	return response.StatusCodeBadRequest
+}
+
+// ServeError answers req with statusCode through the ErrorHandler of the
+// server handling it, or DefaultErrorHandler outside of one, so that
+// middleware turning requests away answers like the server itself. Fields
+// like Retry-After can be queued with w.AddHeaderLine beforehand.
+func ServeError(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+	if s := ServerFromRequest(req); s != nil {
+		s.serveError(w, req, statusCode, err)
+		return
+	}
+	DefaultErrorHandler(w, req, statusCode, err)
+}
+
+// serveError hands a failed request to the configured ErrorHandler.
+func (s *Server) serveError(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+	h := s.opts.ErrorHandler
+	if h == nil {
+		h = DefaultErrorHandler
+	}
+	h(w, req, statusCode, err)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"HTTPFTCP/internal/response"
+)
+
+// ErrTooManyConns is the error the ErrorHandler gets for connections
+// turned away by MaxConns or MaxConnsPerIP.
+var ErrTooManyConns = errors.New("server: too many connections")
+
+// maxRejecting caps how many connections can be getting a 503 at once.
+// Past it they are closed without one, so a flood can't pile up
+// goroutines that way either.
+const maxRejecting = 64
+
+// rejectTimeout bounds how long a rejected client has to take its 503.
+const rejectTimeout = time.Second
+
+// admit applies the connection limits to a newly accepted conn. If it may
+// be served, the returned function gives its place back once it closes;
+// otherwise it has been turned away.
+func (s *Server) admit(conn net.Conn) (func(), bool) {
+	if s.slots != nil && s.opts.RejectOverMax {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			s.reject(conn)
+			return nil, false
+		}
+	}
+	releaseSlot := func() {
+		if s.slots != nil {
+			<-s.slots
+		}
+	}
+	if s.opts.MaxConnsPerIP <= 0 {
+		return releaseSlot, true
+	}
+
+	ip := clientIP(conn)
+	s.mu.Lock()
+	if s.perIP[ip] >= s.opts.MaxConnsPerIP {
+		s.mu.Unlock()
+		releaseSlot()
+		s.reject(conn)
+		return nil, false
+	}
+	s.perIP[ip]++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		if s.perIP[ip]--; s.perIP[ip] <= 0 {
+			delete(s.perIP, ip)
+		}
+		s.mu.Unlock()
+		releaseSlot()
+	}, true
+}
+
+// reject answers conn with 503 Service Unavailable, through the
+// ErrorHandler, and closes it.
+func (s *Server) reject(conn net.Conn) {
+	select {
+	case s.rejecting <- struct{}{}:
+	default:
+		conn.Close()
+		return
+	}
+	go func() {
+		defer func() { <-s.rejecting }()
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(rejectTimeout))
+		w := response.NewWriter(conn)
+		w.AddHeaderLine("Retry-After", strconv.Itoa(int(math.Ceil(s.opts.RetryAfter.Seconds()))))
+		s.serveError(w, nil, response.StatusCodeServiceUnavailable, ErrTooManyConns)
+		// closing with the request unread would reset the connection and
+		// could lose the response, so wait for the client to finish first
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		io.Copy(io.Discard, conn)
+	}()
+}
+
+func clientIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"HTTPFTCP/internal/metrics"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+// Metrics instruments a Server. Set it as Options.Metrics.
+type Metrics struct {
+	requests     *metrics.Counter
+	duration     *metrics.Histogram
+	requestSize  *metrics.Histogram
+	responseSize *metrics.Histogram
+	parseErrors  *metrics.Counter
+	connections  *metrics.Counter
+	active       *metrics.Gauge
+}
+
+// NewMetrics registers the server's metrics with reg. Requests are labelled
+// with their method, status and the Mux pattern they matched, or
+// "unmatched". Sizes are of the whole message as sent on the wire.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	sizes := metrics.ExponentialBuckets(64, 4, 10)
+	return &Metrics{
+		requests:     reg.NewCounter("http_requests_total", "Requests served.", "method", "status", "route"),
+		duration:     reg.NewHistogram("http_request_duration_seconds", "Time from reading a request's head to its handler returning.", metrics.DefBuckets, "method", "route"),
+		requestSize:  reg.NewHistogram("http_request_size_bytes", "Size of requests, head and body.", sizes, "method", "route"),
+		responseSize: reg.NewHistogram("http_response_size_bytes", "Size of responses, head and body.", sizes, "method", "route"),
+		parseErrors:  reg.NewCounter("http_request_parse_errors_total", "Requests that could not be parsed."),
+		connections:  reg.NewCounter("http_connections_total", "Connections accepted."),
+		active:       reg.NewGauge("http_connections_active", "Connections being served."),
+	}
+}
+
+// knownMethods keeps the method label to a fixed set; anything else is
+// counted as OTHER.
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+func (m *Metrics) connOpened() {
+	if m == nil {
+		return
+	}
+	m.connections.Inc()
+	m.active.Inc()
+}
+
+func (m *Metrics) connClosed() {
+	if m == nil {
+		return
+	}
+	m.active.Dec()
+}
+
+func (m *Metrics) parseError() {
+	if m == nil {
+		return
+	}
+	m.parseErrors.Inc()
+}
+
+func (m *Metrics) observe(req *request.Request, w *response.Writer, read int64, took time.Duration) {
+	if m == nil {
+		return
+	}
+	method := req.RequestLine.Method
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	route := Route(req)
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requests.Inc(method, strconv.Itoa(int(w.Status())), route)
+	m.duration.Observe(took.Seconds(), method, route)
+	m.requestSize.Observe(float64(read), method, route)
+	m.responseSize.Observe(float64(w.BytesWritten()), method, route)
+}
+
+// countingReader counts the bytes of a request as they are read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
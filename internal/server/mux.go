@@ -0,0 +1,146 @@
+package server
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+// Mux routes requests by method and path. A pattern ending in "/" matches
+// every path under it and the longest matching pattern wins; any other
+// pattern matches its path exactly.
+//
+// HEAD is answered by the GET handler with the body discarded unless HEAD
+// is registered itself, and OPTIONS is answered with an Allow list unless
+// it is registered. "OPTIONS *" lists every method the Mux handles.
+type Mux struct {
+	routes map[string]map[string]Handler // pattern -> method -> handler
+
+	// NotFound handles requests no pattern matches. Defaults to a plain
+	// 404.
+	NotFound Handler
+}
+
+func NewMux() *Mux {
+	return &Mux{routes: map[string]map[string]Handler{}}
+}
+
+// Handle registers h for method requests to pattern.
+func (m *Mux) Handle(method, pattern string, h Handler) {
+	if pattern == "" || pattern[0] != '/' {
+		panic("server: pattern must start with /: " + pattern)
+	}
+	if m.routes[pattern] == nil {
+		m.routes[pattern] = map[string]Handler{}
+	}
+	m.routes[pattern][method] = h
+}
+
+// ServeRequest dispatches req to the matching handler. It is a Handler.
+func (m *Mux) ServeRequest(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if method == "OPTIONS" && req.RequestLine.RequestTarget == "*" {
+		writeAllow(w, response.StatusCodeNoContent, m.allMethods())
+		return
+	}
+	pattern, methods, ok := m.match(req.Path())
+	if !ok {
+		m.notFound(w, req)
+		return
+	}
+	req.SetValue(routeKey{}, pattern)
+	if h, ok := methods[method]; ok {
+		h(w, req)
+		return
+	}
+	switch method {
+	case "HEAD":
+		if h, ok := methods["GET"]; ok {
+			h(response.DiscardBody(w), req)
+			return
+		}
+	case "OPTIONS":
+		writeAllow(w, response.StatusCodeNoContent, allow(methods))
+		return
+	}
+	writeAllow(w, response.StatusCodeMethodNotAllowed, allow(methods))
+}
+
+func (m *Mux) match(path string) (string, map[string]Handler, bool) {
+	if methods, ok := m.routes[path]; ok {
+		return path, methods, true
+	}
+	best := ""
+	for pattern := range m.routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return "", nil, false
+	}
+	return best, m.routes[best], true
+}
+
+type routeKey struct{}
+
+// Route returns the pattern a Mux matched req against, or "" if no Mux has
+// routed it. Unlike the path, it is safe to use as a metric label.
+func Route(req *request.Request) string {
+	pattern, _ := req.Value(routeKey{}).(string)
+	return pattern
+}
+
+func (m *Mux) allMethods() []string {
+	all := map[string]Handler{}
+	for _, methods := range m.routes {
+		for method, h := range methods {
+			all[method] = h
+		}
+	}
+	return allow(all)
+}
+
+func (m *Mux) notFound(w *response.Writer, req *request.Request) {
+	if m.NotFound != nil {
+		m.NotFound(w, req)
+		return
+	}
+	body := []byte("Not Found\n")
+	w.WriteStatusLine(response.StatusCodeNotFound)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// allow lists the methods in methods plus the ones the Mux adds itself.
+func allow(methods map[string]Handler) []string {
+	list := []string{"OPTIONS"}
+	for method := range methods {
+		list = append(list, method)
+	}
+	if _, ok := methods["GET"]; ok {
+		list = append(list, "HEAD")
+	}
+	slices.Sort(list)
+	return slices.Compact(list)
+}
+
+func writeAllow(w *response.Writer, statusCode response.StatusCode, methods []string) {
+	w.WriteStatusLine(statusCode)
+	h := headers.NewHeaders()
+	h.Set("Allow", strings.Join(methods, ", "))
+	h.Set("Connection", "close")
+	if statusCode == response.StatusCodeNoContent {
+		w.WriteHeaders(h)
+		return
+	}
+	body := []byte("Method Not Allowed\n")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Content-Type", "text/plain")
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMux() *Mux {
+	page := func(body string) Handler {
+		return func(w *response.Writer, _ *request.Request) {
+			w.WriteStatusLine(response.StatusCodeSuccess)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody([]byte(body))
+		}
+	}
+	mux := NewMux()
+	mux.Handle("GET", "/", page("root"))
+	mux.Handle("GET", "/api/", page("api"))
+	mux.Handle("POST", "/api/", page("created"))
+	mux.Handle("GET", "/api/exact", page("exact"))
+	mux.Handle("DELETE", "/things", page("gone"))
+	return mux
+}
+
+func do(mux *Mux, method, target string) *response.Recorder {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	rec, w := response.NewRecorder()
+	mux.ServeRequest(w, req)
+	return rec
+}
+
+func TestMux(t *testing.T) {
+	mux := newMux()
+
+	// Test: Exact match beats the longest prefix
+	assert.Equal(t, "exact", do(mux, "GET", "/api/exact").Body.String())
+	assert.Equal(t, "api", do(mux, "GET", "/api/other?q=1").Body.String())
+	assert.Equal(t, "root", do(mux, "GET", "/nothing/here").Body.String())
+	assert.Equal(t, "created", do(mux, "POST", "/api/").Body.String())
+
+	// Test: HEAD runs GET without the body but keeps Content-Length
+	rec := do(mux, "HEAD", "/api/exact")
+	assert.Equal(t, response.StatusCodeSuccess, rec.StatusCode)
+	assert.Equal(t, "5", rec.Headers["content-length"])
+	assert.Equal(t, 0, rec.Body.Len())
+
+	// Test: OPTIONS lists the route's methods
+	rec = do(mux, "OPTIONS", "/api/thing")
+	assert.Equal(t, response.StatusCodeNoContent, rec.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rec.Headers["allow"])
+
+	// Test: OPTIONS * lists every method
+	rec = do(mux, "OPTIONS", "*")
+	assert.Equal(t, response.StatusCodeNoContent, rec.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, POST", rec.Headers["allow"])
+
+	// Test: Unregistered method gets 405 with Allow
+	rec = do(mux, "PUT", "/things")
+	assert.Equal(t, response.StatusCodeMethodNotAllowed, rec.StatusCode)
+	assert.Equal(t, "DELETE, OPTIONS", rec.Headers["allow"])
+
+	// Test: HEAD without GET is not allowed either
+	rec = do(mux, "HEAD", "/things")
+	assert.Equal(t, response.StatusCodeMethodNotAllowed, rec.StatusCode)
+
+	// Test: The matched pattern is recorded on the request
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/api/other", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	_, w := response.NewRecorder()
+	mux.ServeRequest(w, req)
+	assert.Equal(t, "/api/", Route(req))
+
+	// Test: No match is 404
+	mux = NewMux()
+	mux.Handle("GET", "/only", func(*response.Writer, *request.Request) {})
+	assert.Equal(t, response.StatusCodeNotFound, do(mux, "GET", "/other").StatusCode)
+}
+
+func TestDiscardBody(t *testing.T) {
+	// Test: Chunked bodies and trailers are dropped too
+	rec, w := response.NewRecorder()
+	hw := response.DiscardBody(w)
+	hw.WriteStatusLine(response.StatusCodeSuccess)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	hw.WriteHeaders(h)
+	hw.WriteChunkedBody([]byte("hello"))
+	hw.WriteChunkedBodyDone()
+	hw.WriteTrailers(headers.NewHeaders())
+	assert.Equal(t, "chunked", rec.Headers["transfer-encoding"])
+	assert.Equal(t, 0, rec.Body.Len())
+	assert.False(t, rec.Chunked)
+	assert.Nil(t, rec.Trailers)
+}
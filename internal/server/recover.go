@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"runtime/debug"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+)
+
+// ErrAbortHandler can be panicked with to abort a response on purpose. The
+// connection is cut as for any other panic, but nothing is logged.
+var ErrAbortHandler = errors.New("server: abort handler")
+
+// recoverHandler is deferred around the handler. A panic is logged with
+// the stack and the request. If no status line has gone out yet the
+// ErrorHandler sends a 500; otherwise the connection is reset, so that a
+// partly written response can't pass for a whole one.
+func (s *Server) recoverHandler(c *conn, w *response.Writer, req *request.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v != ErrAbortHandler {
+		log.Printf("server: panic serving %s %s %s: %v\n%s",
+			req.RemoteAddr, req.RequestLine.Method, req.RequestLine.RequestTarget, v, debug.Stack())
+	}
+	c.mu.Lock()
+	hijacked := c.hijacked
+	c.mu.Unlock()
+	switch {
+	case hijacked:
+		// the connection is the handler's now
+	case w.Status() == 0 && v != ErrAbortHandler:
+		s.servePanic(c, w, req, v)
+	default:
+		c.abort()
+	}
+}
+
+// servePanic answers a request whose handler panicked with v with a 500
+// from the ErrorHandler. Should that panic too, the connection is reset.
+func (s *Server) servePanic(c *conn, w *response.Writer, req *request.Request, v any) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("server: panic in error handler: %v", v)
+			c.abort()
+		}
+	}()
+	s.serveError(w, req, response.StatusCodeInternalServerError, fmt.Errorf("panic: %v", v))
+}
+
+// abort closes the connection with a reset rather than an orderly
+// shutdown, so the client sees an error instead of the end of a response.
+func (c *conn) abort() {
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.Conn.Close()
+}
@@ -1,39 +1,116 @@
 package server
 
 import (
+	"context"
 	"net"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"log"
+	"time"
 	"HTTPFTCP/internal/response"
 	"HTTPFTCP/internal/request"
 )
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// Middleware wraps a Handler to add behaviour before or after it runs.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in mws so that the first middleware listed runs first.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
 
 // Server is an HTTP 1.1 server
 type Server struct {
 	handler  Handler
 	listener net.Listener
 	closed   atomic.Bool
+	opts     Options
+
+	slots     chan struct{} // one per connection being served, if MaxConns is set
+	rejecting chan struct{} // one per connection being turned away
+	mu        sync.Mutex
+	perIP     map[string]int
+
+	ctx    context.Context // parent of every request's context
+	cancel context.CancelCauseFunc
+
+	conns      map[uint64]*conn // guarded by mu
+	nextConnID uint64
+}
+
+type Options struct {
+	// MaxConns caps how many connections are served at once. Further
+	// connections wait in the listen backlog until one closes. Zero means
+	// no limit.
+	MaxConns int
+	// RejectOverMax answers connections over MaxConns with 503 straight
+	// away instead of leaving them waiting.
+	RejectOverMax bool
+	// MaxConnsPerIP caps how many connections one client IP may have open.
+	// Further ones are answered with 503. Zero means no limit.
+	MaxConnsPerIP int
+	// RetryAfter is sent with those 503s. Defaults to 1 second.
+	RetryAfter time.Duration
+	// RequestTimeout, if set, cancels each request's context once it has
+	// run this long. Handlers have to watch the context to stop.
+	RequestTimeout time.Duration
+	// Metrics, if set, records requests and connections. See NewMetrics.
+	Metrics *Metrics
+	// ConnState, if set, is called as each connection served changes
+	// state. Connections turned away by the limits above aren't reported.
+	ConnState func(net.Conn, ConnState)
+	// ErrorHandler, if set, writes the responses to requests the server
+	// rejects before or instead of the handler. Defaults to
+	// DefaultErrorHandler.
+	ErrorHandler ErrorHandler
 }
 
 func Serve(port int, handler Handler) (*Server, error) {
+	return ServeWithOptions(port, handler, Options{})
+}
+
+func ServeWithOptions(port int, handler Handler, opts Options) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
 	s := &Server{
-		handler:  handler,
-		listener: listener,
+		handler:   handler,
+		listener:  listener,
+		opts:      opts,
+		rejecting: make(chan struct{}, maxRejecting),
+		perIP:     map[string]int{},
+	}
+	s.ctx, s.cancel = context.WithCancelCause(context.Background())
+	if opts.MaxConns > 0 {
+		s.slots = make(chan struct{}, opts.MaxConns)
 	}
 	go s.listen()
 	return s, nil
 }
 
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections and cancels the context of every
+// request still being handled.
 func (s *Server) Close() error {
 	s.closed.Store(true)
+	if s.cancel != nil {
+		s.cancel(ErrServerClosed)
+	}
 	if s.listener != nil {
 		return s.listener.Close()
 	}
@@ -42,31 +119,95 @@ func (s *Server) Close() error {
 
 func (s *Server) listen() {
 	for {
+		if s.slots != nil && !s.opts.RejectOverMax {
+			// wait for a free slot before accepting, so the kernel's
+			// backlog holds the rest
+			s.slots <- struct{}{}
+		}
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.slots != nil && !s.opts.RejectOverMax {
+				<-s.slots
+			}
 			if s.closed.Load() {
 				return
 			}
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
-		go s.handle(conn)
+		release, ok := s.admit(conn)
+		if !ok {
+			continue
+		}
+		go func() {
+			defer release()
+			s.handle(conn)
+		}()
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
-    defer conn.Close()
+    c := s.track(conn)
+    defer c.close()
+    s.opts.Metrics.connOpened()
+    defer s.opts.Metrics.connClosed()
 
-    w := response.NewWriter(conn)
+    w := response.NewWriter(c)
+    in := &countingReader{r: c}
 
-    req, err := request.RequestFromReader(conn)
+    req, err := request.HeadFromReader(in)
     if err != nil {
-        w.WriteStatusLine(response.StatusCodeBadRequest)
-        body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-        w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-        w.WriteBody(body)
+        s.opts.Metrics.parseError()
+        s.serveError(w, nil, ParseErrorStatus(err), err)
+        return
+    }
+    c.requests.Add(1)
+    start := time.Now()
+    defer func() { s.opts.Metrics.observe(req, w, in.n, time.Since(start)) }()
+    req.RemoteAddr = conn.RemoteAddr().String()
+    ctx, cancel := s.requestContext()
+    defer cancel(nil)
+    req.SetContext(ctx)
+    req.SetValue(connKey{}, c)
+    c.serving(cancel)
+    req.OnBodyRead(func() { c.watch(cancel) })
+    if expect, ok := req.Headers.Get("Expect"); ok && !req.ExpectsContinue() {
+        s.serveError(w, req, response.StatusCodeExpectationFailed, fmt.Errorf("unsupported expectation: %q", expect))
+        return
+    }
+    if err := s.prepareBody(w, req); err != nil {
+        s.serveError(w, req, ParseErrorStatus(err), err)
         return
     }
 
+    defer s.recoverHandler(c, w, req)
     s.handler(w, req)
 }
+
+// prepareBody reads the body straight away unless the client is waiting
+// for 100 Continue, in which case that is sent the first time the handler
+// reads the body. A handler that rejects the request first never asks for
+// it. Multipart bodies are left on the connection too, for
+// request.MultipartReader to stream within its limits.
+func (s *Server) prepareBody(w *response.Writer, req *request.Request) error {
+    if !req.ExpectsContinue() {
+        if mediaType, _, err := req.Headers.GetMediaType(); err == nil && mediaType == "multipart/form-data" {
+            return nil
+        }
+        _, err := req.ReadBody()
+        return err
+    }
+    req.OnContinue(func() {
+        if err := w.WriteInformational(response.StatusCodeContinue, nil); err != nil {
+            log.Printf("Error sending 100 Continue: %v", err)
+        }
+    })
+    return nil
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+    w.WriteStatusLine(statusCode)
+    body := []byte(message)
+    w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+    w.WriteBody(body)
+}
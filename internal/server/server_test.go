@@ -0,0 +1,600 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/metrics"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip serves one connection with h and returns the client end.
+func roundTrip(t *testing.T, h Handler) net.Conn {
+	t.Helper()
+	client, conn := net.Pipe()
+	s := &Server{handler: h}
+	go s.handle(conn)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func echo(w *response.Writer, req *request.Request) {
+	body, err := req.ReadBody()
+	if err != nil {
+		return
+	}
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestExpectContinue(t *testing.T) {
+	// Test: 100 Continue is sent once the handler reads the body
+	client := roundTrip(t, echo)
+	_, err := io.WriteString(client, "PUT / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	require.NoError(t, err)
+	br := bufio.NewReader(client)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, _ = br.ReadString('\n')
+	assert.Equal(t, "\r\n", line)
+	go io.WriteString(client, "hello")
+	rest, _ := io.ReadAll(br)
+	assert.True(t, strings.HasPrefix(string(rest), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(rest), "\r\n\r\nhello"))
+
+	// Test: A handler can reject without reading, and no 100 is sent
+	client = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCodeContentTooLarge)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	io.WriteString(client, "PUT / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 999999\r\n\r\n")
+	out, _ := io.ReadAll(client)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Unknown expectations get 417
+	client = roundTrip(t, echo)
+	io.WriteString(client, "PUT / HTTP/1.1\r\nHost: x\r\nExpect: teapot\r\nContent-Length: 0\r\n\r\n")
+	out, _ = io.ReadAll(client)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 417 Expectation Failed\r\n"))
+
+	// Test: Multipart bodies are left for the handler to stream
+	client = roundTrip(t, func(w *response.Writer, req *request.Request) {
+		buffered := len(req.Body)
+		mr, err := req.MultipartReader(request.MultipartLimits{})
+		require.NoError(t, err)
+		p, err := mr.NextPart()
+		require.NoError(t, err)
+		value, _ := io.ReadAll(p)
+		body := []byte(fmt.Sprintf("%d %s", buffered, value))
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	form := "--b\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nhello\r\n--b--\r\n"
+	go io.WriteString(client, fmt.Sprintf("POST / HTTP/1.1\r\nHost: x\r\nContent-Type: multipart/form-data; boundary=b\r\nContent-Length: %d\r\n\r\n%s", len(form), form))
+	out, _ = io.ReadAll(client)
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\n0 hello"))
+}
+
+func TestConnectionLimits(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 16)
+	slow := func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+		echo(w, req)
+	}
+	start := func(opts Options) *Server {
+		s, err := ServeWithOptions(0, slow, opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	get := func(s *Server) net.Conn {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+		require.NoError(t, err)
+		return conn
+	}
+	readStatus := func(conn net.Conn) string {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return line
+	}
+	// idle waits for s to give back every connection's place.
+	idle := func(s *Server) {
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return len(s.slots) == 0 && len(s.perIP) == 0
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	// Test: Over MaxConns with RejectOverMax gets 503 with Retry-After
+	s := start(Options{MaxConns: 1, RejectOverMax: true, RetryAfter: 2 * time.Second})
+	first := get(s)
+	<-started
+	out, _ := io.ReadAll(get(s))
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 503 Service Unavailable\r\n"))
+	assert.Contains(t, string(out), "Retry-After: 2\r\n")
+
+	// Test: Over MaxConnsPerIP gets 503 too, from the ErrorHandler
+	rejected := make(chan error, 1)
+	s2 := start(Options{MaxConnsPerIP: 1, ErrorHandler: func(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+		rejected <- err
+		DefaultErrorHandler(w, req, statusCode, err)
+	}})
+	second := get(s2)
+	<-started
+	assert.Equal(t, "HTTP/1.1 503 Service Unavailable\r\n", readStatus(get(s2)))
+	assert.Equal(t, ErrTooManyConns, <-rejected)
+
+	// Test: Without RejectOverMax the extra connection waits its turn
+	s3 := start(Options{MaxConns: 1})
+	third := get(s3)
+	<-started
+	waiting := get(s3)
+	waiting.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := waiting.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	close(release)
+	for _, conn := range []net.Conn{first, second, third} {
+		assert.Equal(t, "HTTP/1.1 200 OK\r\n", readStatus(conn))
+	}
+	waiting.SetReadDeadline(time.Time{})
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readStatus(waiting))
+
+	// Test: Slots are given back when connections close
+	idle(s)
+	idle(s2)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readStatus(get(s)))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", readStatus(get(s2)))
+}
+
+func TestRequestContext(t *testing.T) {
+	causes := make(chan error, 1)
+	started := make(chan struct{}, 1)
+	waitForCancel := func(w *response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+	}
+
+	// Test: Client resetting the connection cancels the context
+	s, err := ServeWithOptions(0, waitForCancel, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	c, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	io.WriteString(c, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\n\r\nhi")
+	<-started
+	c.(*net.TCPConn).SetLinger(0)
+	c.Close()
+	assert.Equal(t, ErrClientDisconnected, <-causes)
+
+	// Test: Client half-closing still gets its response
+	s, err = ServeWithOptions(0, func(w *response.Writer, req *request.Request) {
+		<-connFromRequest(req).watching
+		causes <- context.Cause(req.Context())
+		echo(w, req)
+	}, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	c, err = net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	io.WriteString(c, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\n\r\nhi")
+	c.(*net.TCPConn).CloseWrite()
+	assert.NoError(t, <-causes)
+	raw, _ := io.ReadAll(c)
+	assert.True(t, strings.HasPrefix(string(raw), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(raw), "\r\n\r\nhi"))
+
+	// Test: Failing to write to the client cancels the context
+	client := roundTrip(t, func(w *response.Writer, req *request.Request) {
+		<-connFromRequest(req).watching
+		echo(w, req)
+		causes <- context.Cause(req.Context())
+	})
+	io.WriteString(client, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 2\r\n\r\nhi")
+	client.Close()
+	assert.Equal(t, ErrClientDisconnected, <-causes)
+
+	// Test: Closing the connection by ID cancels the context, even with
+	// the body still unread
+	s, err = ServeWithOptions(0, waitForCancel, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	c, err = net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	io.WriteString(c, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	<-started
+	require.Len(t, s.Conns(), 1)
+	assert.True(t, s.CloseConn(s.Conns()[0].ID))
+	assert.Equal(t, ErrClientDisconnected, <-causes)
+
+	// Test: Timeout cancels the context
+	client, conn := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	s = &Server{handler: waitForCancel, opts: Options{RequestTimeout: 20 * time.Millisecond}}
+	go s.handle(conn)
+	io.WriteString(client, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	<-started
+	assert.Equal(t, ErrRequestTimeout, <-causes)
+
+	// Test: Closing the server cancels requests in flight
+	s, err = ServeWithOptions(0, waitForCancel, Options{})
+	require.NoError(t, err)
+	c, err = net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	<-started
+	s.Close()
+	assert.Equal(t, ErrServerClosed, <-causes)
+}
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	mux := NewMux()
+	mux.Handle("POST", "/items/", echo)
+	s := &Server{handler: mux.ServeRequest, opts: Options{Metrics: NewMetrics(reg)}}
+	do := func(raw string) string {
+		client, conn := net.Pipe()
+		defer client.Close()
+		done := make(chan struct{})
+		go func() {
+			s.handle(conn)
+			close(done)
+		}()
+		go io.WriteString(client, raw)
+		resp, _ := io.ReadAll(client)
+		<-done
+		return string(resp)
+	}
+
+	// Test: Requests are counted by method, status and route, with sizes
+	// as sent on the wire
+	const post = "POST /items/42 HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello"
+	resp := do(post)
+	do("BREW /pot HTTP/1.1\r\nHost: x\r\n\r\n")
+	do("nonsense\r\n\r\n")
+	var b strings.Builder
+	require.NoError(t, reg.WriteText(&b))
+	out := b.String()
+	assert.Contains(t, out, `http_requests_total{method="POST",status="200",route="/items/"} 1`)
+	assert.Contains(t, out, `http_requests_total{method="OTHER",status="404",route="unmatched"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_count{method="POST",route="/items/"} 1`)
+	assert.Contains(t, out, fmt.Sprintf(`http_request_size_bytes_sum{method="POST",route="/items/"} %d`, len(post)))
+	assert.Contains(t, out, fmt.Sprintf(`http_response_size_bytes_sum{method="POST",route="/items/"} %d`, len(resp)))
+	assert.Contains(t, out, "http_request_parse_errors_total 1\n")
+
+	// Test: Connections are counted as they open and close
+	assert.Contains(t, out, "http_connections_total 3\n")
+	assert.Contains(t, out, "http_connections_active 0\n")
+}
+
+func TestConnState(t *testing.T) {
+	type change struct {
+		addr  string
+		state ConnState
+	}
+	changes := make(chan change, 32)
+	release := make(chan struct{})
+	mux := NewMux()
+	mux.Handle("POST", "/slow", func(w *response.Writer, req *request.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+		echo(w, req)
+	})
+	mux.Handle("GET", "/admin/conns", ConnsHandler)
+	mux.Handle("DELETE", "/admin/conns/", ConnsHandler)
+	mux.Handle("GET", "/upgrade", func(w *response.Writer, req *request.Request) {
+		conn, err := Hijack(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = Hijack(req)
+		assert.ErrorIs(t, err, ErrHijacked)
+		go func() {
+			defer conn.Close()
+			io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\n\r\n")
+			io.Copy(conn, conn)
+		}()
+	})
+	s, err := ServeWithOptions(0, mux.ServeRequest, Options{ConnState: func(c net.Conn, st ConnState) {
+		changes <- change{c.RemoteAddr().String(), st}
+	}})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	next := func(c net.Conn) ConnState {
+		select {
+		case ch := <-changes:
+			assert.Equal(t, c.LocalAddr().String(), ch.addr)
+			return ch.state
+		case <-time.After(5 * time.Second):
+			t.Fatal("no state change")
+			return -1
+		}
+	}
+
+	// Test: A connection is new until it sends something, then active
+	slow := dial()
+	assert.Equal(t, StateNew, next(slow))
+	io.WriteString(slow, "POST /slow HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello")
+	assert.Equal(t, StateActive, next(slow))
+
+	// Test: The server keeps stats on each connection
+	require.Eventually(t, func() bool {
+		conns := s.Conns()
+		return len(conns) == 1 && conns[0].BytesIn == int64(len("POST /slow HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello"))
+	}, 5*time.Second, 10*time.Millisecond)
+	info := s.Conns()[0]
+	assert.Equal(t, slow.LocalAddr().String(), info.RemoteAddr)
+	assert.Equal(t, StateActive, info.State)
+	assert.Equal(t, int64(1), info.Requests)
+	assert.Equal(t, int64(0), info.BytesOut)
+	assert.WithinDuration(t, time.Now(), info.Created, 5*time.Second)
+
+	// Test: The admin handler lists connections, itself included
+	admin := dial()
+	next(admin)
+	io.WriteString(admin, "GET /admin/conns HTTP/1.1\r\nHost: x\r\n\r\n")
+	next(admin)
+	out, _ := io.ReadAll(admin)
+	assert.Equal(t, StateClosed, next(admin))
+	body := string(out[strings.Index(string(out), "\r\n\r\n")+4:])
+	var listed []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &listed))
+	require.Len(t, listed, 2)
+	assert.Equal(t, float64(info.ID), listed[0]["id"])
+	assert.Equal(t, "active", listed[0]["state"])
+	assert.Equal(t, float64(1), listed[0]["requests"])
+	assert.Contains(t, listed[0], "age_seconds")
+
+	// Test: It closes a connection by ID
+	admin = dial()
+	next(admin)
+	fmt.Fprintf(admin, "DELETE /admin/conns/%d HTTP/1.1\r\nHost: x\r\n\r\n", info.ID)
+	next(admin)
+	out, _ = io.ReadAll(admin)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 204 No Content\r\n"))
+	closed := map[string]ConnState{}
+	for range 2 {
+		ch := <-changes
+		closed[ch.addr] = ch.state
+	}
+	assert.Equal(t, map[string]ConnState{admin.LocalAddr().String(): StateClosed, slow.LocalAddr().String(): StateClosed}, closed)
+	_, err = io.ReadAll(slow)
+	assert.NoError(t, err)
+	admin = dial()
+	next(admin)
+	io.WriteString(admin, "DELETE /admin/conns/999 HTTP/1.1\r\nHost: x\r\n\r\n")
+	next(admin)
+	out, _ = io.ReadAll(admin)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 404 Not Found\r\n"))
+	next(admin)
+
+	// Test: A hijacked connection is the handler's to keep
+	up := dial()
+	next(up)
+	io.WriteString(up, "GET /upgrade HTTP/1.1\r\nHost: x\r\n\r\nearly\n")
+	assert.Equal(t, StateActive, next(up))
+	assert.Equal(t, StateHijacked, next(up))
+	br := bufio.NewReader(up)
+	line, _ := br.ReadString('\n')
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", line)
+	br.ReadString('\n')
+	br.ReadString('\n')
+	line, _ = br.ReadString('\n')
+	assert.Equal(t, "early\n", line)
+	io.WriteString(up, "ping\n")
+	line, _ = br.ReadString('\n')
+	assert.Equal(t, "ping\n", line)
+	assert.Empty(t, s.Conns())
+	assert.Len(t, changes, 0)
+	close(release)
+}
+
+// syncBuffer is a strings.Builder the server's goroutines can log to.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.b.Reset()
+}
+
+func TestPanics(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	mux := NewMux()
+	mux.Handle("GET", "/early", func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})
+	mux.Handle("GET", "/late", func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(100))
+		w.WriteBody([]byte("partial"))
+		panic("bang")
+	})
+	mux.Handle("GET", "/abort", func(w *response.Writer, req *request.Request) {
+		panic(ErrAbortHandler)
+	})
+	s, err := ServeWithOptions(0, mux.ServeRequest, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	get := func(target string) (string, error) {
+		c, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer c.Close()
+		io.WriteString(c, "GET "+target+" HTTP/1.1\r\nHost: x\r\n\r\n")
+		out, err := io.ReadAll(c)
+		return string(out), err
+	}
+
+	// Test: A panic before the response starts is a 500, and logged with
+	// the request and stack
+	out, err := get("/early")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, out, "boom")
+	assert.Regexp(t, `server: panic serving \S+:\d+ GET /early: boom\n`, logs.String())
+	assert.Contains(t, logs.String(), "runtime/debug.Stack")
+
+	// Test: A panic mid-response resets the connection
+	_, err = get("/late")
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "GET /late: bang")
+
+	// Test: ErrAbortHandler aborts without logging
+	logs.Reset()
+	_, err = get("/abort")
+	assert.Error(t, err)
+	assert.Empty(t, logs.String())
+
+	// Test: The server carries on
+	out, err = get("/early")
+	require.NoError(t, err)
+	assert.Contains(t, out, "500")
+}
+
+func TestErrorHandler(t *testing.T) {
+	send := func(s *Server, raw string) string {
+		client, conn := net.Pipe()
+		defer client.Close()
+		go s.handle(conn)
+		go io.WriteString(client, raw)
+		out, _ := io.ReadAll(client)
+		return string(out)
+	}
+
+	// Test: By default parse errors get their status and kind of error,
+	// but not the request echoed back
+	s := &Server{handler: echo}
+	out := send(s, "GET /<script> HTTP/1.1 extra\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nBad Request: malformed request line\n"))
+	assert.NotContains(t, out, "<script>")
+	out = send(s, "GET / HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 505 HTTP Version Not Supported\r\n"))
+
+	// Test: A custom ErrorHandler renders the error pages, with no request
+	// when it couldn't be parsed
+	type call struct {
+		req    *request.Request
+		status response.StatusCode
+		err    error
+	}
+	calls := make(chan call, 1)
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	}, opts: Options{ErrorHandler: func(w *response.Writer, req *request.Request, statusCode response.StatusCode, err error) {
+		calls <- call{req, statusCode, err}
+		body := []byte(`{"error":"oops"}`)
+		h := response.GetDefaultHeaders(len(body))
+		h.Override("Content-Type", "application/json")
+		w.WriteStatusLine(statusCode)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	}}}
+	out = send(s, "GET / HTTP/1.1\r\nHost localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"+`{"error":"oops"}`))
+	c := <-calls
+	assert.Nil(t, c.req)
+	assert.Equal(t, response.StatusCodeBadRequest, c.status)
+	assert.ErrorIs(t, c.err, request.ErrMalformedHeader)
+
+	// Test: It is also used for unmet expectations and panics
+	out = send(s, "PUT /x HTTP/1.1\r\nExpect: teapot\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 417 Expectation Failed\r\n"))
+	c = <-calls
+	require.NotNil(t, c.req)
+	assert.Equal(t, "/x", c.req.RequestLine.RequestTarget)
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	out = send(s, "GET /y HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+	c = <-calls
+	assert.Equal(t, "/y", c.req.RequestLine.RequestTarget)
+	assert.EqualError(t, c.err, "panic: boom")
+
+	// Test: Middleware reaches it through ServeError
+	errBusy := errors.New("busy")
+	s.handler = func(w *response.Writer, req *request.Request) {
+		ServeError(w, req, response.StatusCodeServiceUnavailable, errBusy)
+	}
+	out = send(s, "GET /z HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 503 Service Unavailable\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"+`{"error":"oops"}`))
+	c = <-calls
+	assert.Equal(t, "/z", c.req.RequestLine.RequestTarget)
+	assert.Equal(t, errBusy, c.err)
+
+	// Test: A body cut short is a 400 from the ErrorHandler too
+	s.handler = echo
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			s.handle(conn)
+		}
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	io.WriteString(client, "PUT / HTTP/1.1\r\nContent-Length: 10\r\n\r\nabc")
+	client.(*net.TCPConn).CloseWrite()
+	raw, _ := io.ReadAll(client)
+	out = string(raw)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+	c = <-calls
+	assert.ErrorIs(t, c.err, request.ErrBodyTooShort)
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backend loads and saves sessions. Cookie backends keep the whole session
+// in the cookie value; the server-side backend keeps only its ID there.
+type Backend interface {
+	// Load returns the session for a cookie value, or ErrInvalid.
+	Load(value string) (*Session, error)
+	// Save stores s and returns the value for the session cookie.
+	Save(s *Session) (string, error)
+	// Delete forgets s.
+	Delete(s *Session) error
+}
+
+// payload is what cookie backends put in the cookie.
+type payload struct {
+	ID      string            `json:"id"`
+	Values  map[string]string `json:"v"`
+	Expires int64             `json:"exp"`
+}
+
+func encodePayload(s *Session) ([]byte, error) {
+	return json.Marshal(payload{ID: s.ID, Values: s.Values, Expires: s.Expires.Unix()})
+}
+
+func decodePayload(data []byte) (*Session, error) {
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, ErrInvalid
+	}
+	expires := time.Unix(p.Expires, 0)
+	if !time.Now().Before(expires) {
+		return nil, ErrInvalid
+	}
+	if p.Values == nil {
+		p.Values = map[string]string{}
+	}
+	return &Session{ID: p.ID, Values: p.Values, Expires: expires}, nil
+}
+
+// SignedCookie keeps sessions in the cookie, signed with HMAC-SHA256. The
+// values can be read by the client but not changed.
+type SignedCookie struct {
+	keys [][]byte
+}
+
+// NewSignedCookie signs with the first key and accepts signatures from any
+// of them, so keys can be rotated by adding the new one at the front and
+// dropping the old one once its cookies have expired.
+func NewSignedCookie(keys ...[]byte) (*SignedCookie, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: at least one key is required")
+	}
+	for _, k := range keys {
+		if len(k) < 32 {
+			return nil, errors.New("session: signing keys must be at least 32 bytes")
+		}
+	}
+	return &SignedCookie{keys: keys}, nil
+}
+
+func (c *SignedCookie) Load(value string) (*Session, error) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	verified := false
+	for _, k := range c.keys {
+		if hmac.Equal(mac, sign(k, encoded)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return decodePayload(data)
+}
+
+func (c *SignedCookie) Save(s *Session) (string, error) {
+	data, err := encodePayload(s)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(c.keys[0], encoded)), nil
+}
+
+func (c *SignedCookie) Delete(*Session) error {
+	return nil
+}
+
+func sign(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// EncryptedCookie keeps sessions in the cookie, encrypted and authenticated
+// with AES-GCM so the client can neither read nor change them.
+type EncryptedCookie struct {
+	aeads []cipher.AEAD
+}
+
+// NewEncryptedCookie takes 16, 24 or 32 byte AES keys. It encrypts with the
+// first and decrypts with any of them, so keys rotate the same way as for
+// NewSignedCookie.
+func NewEncryptedCookie(keys ...[]byte) (*EncryptedCookie, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: at least one key is required")
+	}
+	c := &EncryptedCookie{}
+	for _, k := range keys {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("session: %w", err)
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+func (c *EncryptedCookie) Load(value string) (*Session, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	for _, aead := range c.aeads {
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrInvalid
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		data, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err == nil {
+			return decodePayload(data)
+		}
+	}
+	return nil, ErrInvalid
+}
+
+func (c *EncryptedCookie) Save(s *Session) (string, error) {
+	data, err := encodePayload(s)
+	if err != nil {
+		return "", err
+	}
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+func (c *EncryptedCookie) Delete(*Session) error {
+	return nil
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+type Options struct {
+	// CookieName defaults to "session".
+	CookieName string
+	// MaxAge is how long a session lasts after it was last saved. Defaults
+	// to 24 hours.
+	MaxAge   time.Duration
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite headers.SameSite
+}
+
+type contextKey struct{}
+
+// FromRequest returns the session the middleware attached to req, or nil
+// if the middleware isn't installed.
+func FromRequest(req *request.Request) *Session {
+	s, _ := req.Value(contextKey{}).(*Session)
+	return s
+}
+
+// Middleware loads the session from its cookie before calling the handler,
+// and saves it, setting the cookie, when the handler writes its headers.
+func Middleware(backend Backend, opts Options) server.Middleware {
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 24 * time.Hour
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == headers.SameSiteDefault {
+		opts.SameSite = headers.SameSiteLax
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			s := load(backend, req, opts.CookieName)
+			req.SetValue(contextKey{}, s)
+			ss := &saveSink{Writer: w, backend: backend, opts: &opts, session: s}
+			next(response.NewSinkWriter(ss), req)
+			switch {
+			case !s.modified:
+			case !ss.wroteHeaders:
+				// the handler never wrote headers; nothing to attach a cookie to
+				log.Printf("session: %s modified but no response headers were written", opts.CookieName)
+			case !s.destroyed && (s.previousID != "" || s.ID != ss.id):
+				// the client keeps the ID it already has, so saving under
+				// a new one would log it out
+				log.Printf("session: %s ID regenerated after the response headers were written; not saved", opts.CookieName)
+			default:
+				// values changed after the cookie went out; the ID in it is
+				// still good for server-side sessions
+				if _, ok := backend.(*ServerSide); ok {
+					if err := ss.save(); err != nil {
+						log.Printf("session: error saving: %v", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func load(backend Backend, req *request.Request, name string) *Session {
+	c, err := req.Cookie(name)
+	if err != nil {
+		return newSession()
+	}
+	s, err := backend.Load(c.Value)
+	if err != nil {
+		if !errors.Is(err, ErrInvalid) {
+			log.Printf("session: error loading: %v", err)
+		}
+		return newSession()
+	}
+	return s
+}
+
+// saveSink saves the session just before the response headers go out, so
+// its cookie can be included.
+type saveSink struct {
+	*response.Writer
+	backend Backend
+	opts    *Options
+	session *Session
+
+	// wroteHeaders and id note that the headers have gone out and the
+	// session ID the client holds since
+	wroteHeaders bool
+	id           string
+}
+
+func (s *saveSink) WriteHeaders(h headers.Headers) error {
+	if s.session.modified {
+		if err := s.save(); err != nil {
+			log.Printf("session: error saving: %v", err)
+		}
+		// a stored session must not be served to anyone else
+		if _, ok := h.Get("Cache-Control"); !ok {
+			h.Override("Cache-Control", "private, no-store")
+		}
+	}
+	s.wroteHeaders = true
+	s.id = s.session.ID
+	return s.Writer.WriteHeaders(h)
+}
+
+// save persists the session and queues its Set-Cookie line if the headers
+// haven't gone out yet.
+func (s *saveSink) save() error {
+	sess := s.session
+	defer func() { sess.modified = false }()
+	cookie := &headers.Cookie{
+		Name:     s.opts.CookieName,
+		Path:     s.opts.Path,
+		Domain:   s.opts.Domain,
+		Secure:   s.opts.Secure,
+		HttpOnly: true,
+		SameSite: s.opts.SameSite,
+	}
+	if sess.destroyed {
+		if err := s.backend.Delete(sess); err != nil {
+			return err
+		}
+		cookie.MaxAge = -1
+		if s.wroteHeaders {
+			return nil
+		}
+		return s.Writer.SetCookie(cookie)
+	}
+
+	sess.Expires = time.Now().Add(s.opts.MaxAge).Truncate(time.Second)
+	value, err := s.backend.Save(sess)
+	if err != nil {
+		return err
+	}
+	if s.wroteHeaders {
+		return nil
+	}
+	cookie.Value = value
+	cookie.MaxAge = int(s.opts.MaxAge / time.Second)
+	return s.Writer.SetCookie(cookie)
+}
@@ -0,0 +1,83 @@
+// Package session keeps per-user state across requests, either in the
+// session cookie itself or in a server-side Store keyed by a cookie.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// ErrInvalid means a session cookie failed verification, decryption or has
+// expired. The middleware treats it the same as having no cookie.
+var ErrInvalid = errors.New("invalid session")
+
+// Session is the state for one client. It isn't safe for concurrent use.
+type Session struct {
+	ID     string
+	Values map[string]string
+	// Expires is when the session stops being valid.
+	Expires time.Time
+	// IsNew is set for sessions created on this request.
+	IsNew bool
+
+	modified  bool
+	destroyed bool
+	// previousID is the ID the session had before RegenerateID, so the
+	// backend can drop it.
+	previousID string
+}
+
+func newSession() *Session {
+	return &Session{ID: newID(), Values: map[string]string{}, IsNew: true}
+}
+
+func (s *Session) Get(key string) (string, bool) {
+	v, ok := s.Values[key]
+	return v, ok
+}
+
+func (s *Session) Set(key, value string) {
+	s.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	if _, ok := s.Values[key]; ok {
+		delete(s.Values, key)
+		s.modified = true
+	}
+}
+
+// Destroy ends the session, removing it from the store and clearing the
+// cookie.
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.modified = true
+	s.Values = map[string]string{}
+}
+
+// RegenerateID gives the session a fresh ID while keeping its values. Call
+// it when a user logs in so a session ID planted before login is useless.
+func (s *Session) RegenerateID() {
+	if s.previousID == "" && !s.IsNew {
+		s.previousID = s.ID
+	}
+	s.ID = newID()
+	s.modified = true
+}
+
+// Modified reports whether the session needs saving.
+func (s *Session) Modified() bool {
+	return s.modified
+}
+
+// newID returns 256 random bits, URL-safe base64 encoded.
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestCookieBackends(t *testing.T) {
+	s := newSession()
+	s.Set("user", "gopher")
+	s.Expires = time.Now().Add(time.Hour)
+
+	// Test: Signed cookie round trip and tampering
+	signed, err := NewSignedCookie(key(1))
+	require.NoError(t, err)
+	v, err := signed.Save(s)
+	require.NoError(t, err)
+	loaded, err := signed.Load(v)
+	require.NoError(t, err)
+	assert.Equal(t, "gopher", loaded.Values["user"])
+	assert.Equal(t, s.ID, loaded.ID)
+	_, err = signed.Load("x" + v)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// Test: Rotated keys still verify old cookies
+	rotated, err := NewSignedCookie(key(2), key(1))
+	require.NoError(t, err)
+	_, err = rotated.Load(v)
+	require.NoError(t, err)
+	retired, err := NewSignedCookie(key(2))
+	require.NoError(t, err)
+	_, err = retired.Load(v)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	// Test: Encrypted cookie hides values and rotates
+	enc, err := NewEncryptedCookie(key(3))
+	require.NoError(t, err)
+	v, err = enc.Save(s)
+	require.NoError(t, err)
+	assert.NotContains(t, v, "gopher")
+	enc2, err := NewEncryptedCookie(key(4), key(3))
+	require.NoError(t, err)
+	loaded, err = enc2.Load(v)
+	require.NoError(t, err)
+	assert.Equal(t, "gopher", loaded.Values["user"])
+
+	// Test: Expired cookie is rejected
+	s.Expires = time.Now().Add(-time.Second)
+	v, err = enc.Save(s)
+	require.NoError(t, err)
+	_, err = enc.Load(v)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+var setCookieRe = regexp.MustCompile(`Set-Cookie: sid=([^;]*);`)
+
+func run(t *testing.T, h func(*response.Writer, *request.Request), cookie string) string {
+	var buf bytes.Buffer
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	if cookie != "" {
+		req.Headers.Set("Cookie", "sid="+cookie)
+	}
+	h(response.NewWriter(&buf), req)
+	m := setCookieRe.FindStringSubmatch(buf.String())
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	var seen string
+	handler := func(w *response.Writer, req *request.Request) {
+		s := FromRequest(req)
+		seen, _ = s.Get("user")
+		switch {
+		case seen == "":
+			s.Set("user", "gopher")
+		case strings.HasPrefix(seen, "gopher"):
+			s.RegenerateID()
+		}
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	}
+	h := Middleware(NewServerSide(store), Options{CookieName: "sid"})(handler)
+
+	// Test: First request creates a session
+	id := run(t, h, "")
+	require.NotEmpty(t, id)
+	values, _, ok, err := store.Get(id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "gopher", values["user"])
+
+	// Test: Session is loaded and the ID regenerated, dropping the old one
+	newID := run(t, h, id)
+	assert.Equal(t, "gopher", seen)
+	require.NotEmpty(t, newID)
+	assert.NotEqual(t, id, newID)
+	_, _, ok, _ = store.Get(id)
+	assert.False(t, ok)
+	_, _, ok, _ = store.Get(newID)
+	assert.True(t, ok)
+
+	// Test: Unknown session ID starts fresh
+	run(t, h, strings.Repeat("A", 43))
+	assert.Equal(t, "", seen)
+
+	// Test: Values changed after the headers still reach the store
+	late := Middleware(NewServerSide(store), Options{CookieName: "sid"})(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+		s := FromRequest(req)
+		s.Set("theme", "dark")
+		if req.RequestLine.RequestTarget == "/regenerate" {
+			s.RegenerateID()
+		}
+	})
+	assert.Empty(t, run(t, late, newID))
+	values, _, ok, err = store.Get(newID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "dark", values["theme"])
+
+	// Test: A regenerated ID after the headers isn't saved, keeping the
+	// session the client's cookie points at
+	var buf bytes.Buffer
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/regenerate", HttpVersion: "1.1"},
+		Headers:     headers.Headers{"cookie": "sid=" + newID},
+	}
+	late(response.NewWriter(&buf), req)
+	assert.NotContains(t, buf.String(), "Set-Cookie")
+	_, _, ok, _ = store.Get(newID)
+	assert.True(t, ok)
+}
+
+func TestFileStore(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	id := newID()
+
+	// Test: Values survive a round trip
+	require.NoError(t, fs.Set(id, map[string]string{"a": "b"}, time.Now().Add(time.Hour)))
+	values, _, ok, err := fs.Get(id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "b", values["a"])
+
+	// Test: Expired sessions are gone
+	require.NoError(t, fs.Set(id, map[string]string{"a": "b"}, time.Now().Add(-time.Second)))
+	_, _, ok, err = fs.Get(id)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Test: IDs that could escape the directory are refused
+	_, _, ok, _ = fs.Get("../../etc/passwd")
+	assert.False(t, ok)
+}
@@ -0,0 +1,245 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps session values on the server, keyed by session ID. Entries
+// past their expiry must not be returned. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Get(id string) (values map[string]string, expires time.Time, ok bool, err error)
+	Set(id string, values map[string]string, expires time.Time) error
+	Delete(id string) error
+}
+
+// ServerSide is a Backend that keeps sessions in a Store and only the
+// session ID in the cookie.
+type ServerSide struct {
+	store Store
+}
+
+func NewServerSide(store Store) *ServerSide {
+	return &ServerSide{store: store}
+}
+
+func (b *ServerSide) Load(value string) (*Session, error) {
+	if !validID(value) {
+		return nil, ErrInvalid
+	}
+	values, expires, ok, err := b.store.Get(value)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalid
+	}
+	return &Session{ID: value, Values: values, Expires: expires}, nil
+}
+
+func (b *ServerSide) Save(s *Session) (string, error) {
+	if s.previousID != "" {
+		if err := b.store.Delete(s.previousID); err != nil {
+			return "", err
+		}
+		s.previousID = ""
+	}
+	if err := b.store.Set(s.ID, s.Values, s.Expires); err != nil {
+		return "", err
+	}
+	return s.ID, nil
+}
+
+func (b *ServerSide) Delete(s *Session) error {
+	if s.previousID != "" {
+		if err := b.store.Delete(s.previousID); err != nil {
+			return err
+		}
+	}
+	return b.store.Delete(s.ID)
+}
+
+// validID checks that id looks like one of ours, which also keeps it safe to
+// use as a file name.
+func validID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	})
+}
+
+// MemoryStore is an in-memory Store. Expired sessions are swept out
+// periodically as new ones are saved.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memorySession struct {
+	values  map[string]string
+	expires time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]memorySession{}, now: time.Now}
+}
+
+func (m *MemoryStore) Get(id string) (map[string]string, time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, time.Time{}, false, nil
+	}
+	if !m.now().Before(s.expires) {
+		delete(m.sessions, id)
+		return nil, time.Time{}, false, nil
+	}
+	values := make(map[string]string, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return values, s.expires, true, nil
+}
+
+func (m *MemoryStore) Set(id string, values map[string]string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	m.sessions[id] = memorySession{values: copied, expires: expires}
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.lastSweep = now
+		for id, s := range m.sessions {
+			if !now.Before(s.expires) {
+				delete(m.sessions, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// FileStore is a Store that keeps each session in its own JSON file.
+type FileStore struct {
+	dir string
+	now func() time.Time
+}
+
+type fileSession struct {
+	Values  map[string]string `json:"values"`
+	Expires time.Time         `json:"expires"`
+}
+
+// NewFileStore keeps sessions in dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrInvalid
+	}
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+func (f *FileStore) Get(id string) (map[string]string, time.Time, bool, error) {
+	p, err := f.path(id)
+	if err != nil {
+		return nil, time.Time{}, false, nil
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	var s fileSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, time.Time{}, false, nil
+	}
+	if !f.now().Before(s.Expires) {
+		os.Remove(p)
+		return nil, time.Time{}, false, nil
+	}
+	return s.Values, s.Expires, true, nil
+}
+
+func (f *FileStore) Set(id string, values map[string]string, expires time.Time) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(fileSession{Values: values, Expires: expires})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (f *FileStore) Delete(id string) error {
+	p, err := f.path(id)
+	if err != nil {
+		return nil
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Sweep removes expired session files. Run it now and then.
+func (f *FileStore) Sweep() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if ok {
+			// Get removes the file if it has expired
+			f.Get(id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is a stub OTLP/HTTP collector that keeps what it is sent.
+func collector(t *testing.T) (*httptest.Server, chan map[string]any) {
+	t.Helper()
+	requests := make(chan map[string]any, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		assert.NoError(t, json.Unmarshal(body, &req))
+		requests <- req
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+// exported digs the resource and spans out of an export request.
+func exported(req map[string]any) (resource map[string]any, spans []any) {
+	rs := req["resourceSpans"].([]any)[0].(map[string]any)
+	ss := rs["scopeSpans"].([]any)[0].(map[string]any)
+	assert.Equal(nil, scopeName, ss["scope"].(map[string]any)["name"])
+	return rs["resource"].(map[string]any), ss["spans"].([]any)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	srv, requests := collector(t)
+	exp := NewOTLPExporter(OTLPOptions{
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "test-service",
+		Headers:     map[string]string{"Api-Key": "secret"},
+		BatchSize:   2,
+		Interval:    time.Hour,
+	})
+	h := Middleware(Options{Exporter: exp})(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	serve := func() {
+		_, w := response.NewRecorder()
+		h(w, newRequest("GET", "/a", "traceparent", parent, "tracestate", "rojo=1"))
+	}
+
+	// Test: A full batch is sent straight away, in OTLP's JSON encoding
+	serve()
+	serve()
+	var req map[string]any
+	select {
+	case req = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export")
+	}
+	resource, spans := exported(req)
+	assert.Equal(t, []any{map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "test-service"}}}, resource["attributes"])
+	require.Len(t, spans, 2)
+	span := spans[0].(map[string]any)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Len(t, span["spanId"], 16)
+	assert.Equal(t, "00f067aa0ba902b7", span["parentSpanId"])
+	assert.Equal(t, "rojo=1", span["traceState"])
+	assert.Equal(t, float64(1), span["flags"])
+	assert.Equal(t, "GET", span["name"])
+	assert.Equal(t, float64(KindServer), span["kind"])
+	assert.Regexp(t, `^\d+$`, span["startTimeUnixNano"])
+	assert.Regexp(t, `^\d+$`, span["endTimeUnixNano"])
+	assert.Contains(t, span["attributes"], map[string]any{"key": "http.response.status_code", "value": map[string]any{"intValue": "200"}})
+	assert.Contains(t, span["attributes"], map[string]any{"key": "url.path", "value": map[string]any{"stringValue": "/a"}})
+	assert.Equal(t, map[string]any{}, span["status"])
+
+	// Test: Shutdown sends what is left over
+	serve()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, exp.Shutdown(ctx))
+	require.Len(t, requests, 1)
+	_, spans = exported(<-requests)
+	assert.Len(t, spans, 1)
+
+	// Test: Spans after shutdown are dropped, not sent
+	serve()
+	assert.NoError(t, exp.Shutdown(ctx))
+	assert.Len(t, requests, 0)
+}
+
+func TestOTLPInterval(t *testing.T) {
+	srv, requests := collector(t)
+	exp := NewOTLPExporter(OTLPOptions{
+		Endpoint:  srv.URL + "/v1/traces",
+		Headers:   map[string]string{"Api-Key": "secret"},
+		BatchSize: 100,
+		Interval:  20 * time.Millisecond,
+	})
+	defer exp.Shutdown(context.Background())
+
+	// Test: A part batch goes out once the interval passes
+	exp.Export(SpanData{Name: "lone", Kind: KindClient, Status: StatusError, StatusMessage: "boom",
+		SpanContext: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Sampled: true}})
+	select {
+	case req := <-requests:
+		resource, spans := exported(req)
+		assert.Contains(t, resource["attributes"].([]any)[0].(map[string]any)["value"].(map[string]any)["stringValue"], "unknown_service:")
+		span := spans[0].(map[string]any)
+		assert.Equal(t, "lone", span["name"])
+		assert.NotContains(t, span, "parentSpanId")
+		assert.Equal(t, map[string]any{"code": float64(StatusError), "message": "boom"}, span["status"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export")
+	}
+}
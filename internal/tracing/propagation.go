@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// TraceID identifies a trace; all zeros is invalid.
+type TraceID [16]byte
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within its trace; all zeros is invalid.
+type SpanID [8]byte
+
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// flagSampled is the only trace flag defined by W3C Trace Context.
+const flagSampled = 0x01
+
+// SpanContext is what is passed from one service to the next in the
+// traceparent and tracestate fields.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// TraceState is the vendor-specific tracestate list, passed on as it
+	// came.
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a version 00 traceparent value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// traceparentLength is the length of a version 00 traceparent.
+const traceparentLength = 55
+
+// ParseTraceparent parses a traceparent value (W3C Trace Context section
+// 3.2). Versions after 00 are read as far as 00 goes, as the spec asks.
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+	if len(v) < traceparentLength || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	version, ok := parseHex(v[0:2])
+	if !ok || version[0] == 0xff {
+		return sc, ErrInvalidTraceparent
+	}
+	if version[0] == 0 && len(v) != traceparentLength {
+		return sc, ErrInvalidTraceparent
+	}
+	if len(v) > traceparentLength && v[traceparentLength] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, ok1 := parseHex(v[3:35])
+	spanID, ok2 := parseHex(v[36:52])
+	flags, ok3 := parseHex(v[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&flagSampled != 0
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// parseHex decodes lowercase hex only, as traceparent requires.
+func parseHex(s string) ([]byte, bool) {
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// maxTraceStateMembers is the most list members tracestate may carry.
+const maxTraceStateMembers = 32
+
+var (
+	traceStateKey   = regexp.MustCompile(`^([a-z][a-z0-9_*/-]{0,255}|[a-z0-9][a-z0-9_*/-]{0,240}@[a-z][a-z0-9_*/-]{0,13})$`)
+	traceStateValue = regexp.MustCompile(`^[\x20-\x2b\x2d-\x3c\x3e-\x7e]{0,255}[\x21-\x2b\x2d-\x3c\x3e-\x7e]$`)
+)
+
+// ValidTraceState reports whether v is a well-formed tracestate list
+// (W3C Trace Context section 3.3). A malformed one is dropped rather than
+// passed on.
+func ValidTraceState(v string) bool {
+	members := 0
+	seen := map[string]bool{}
+	for _, m := range strings.Split(v, ",") {
+		m = strings.Trim(m, " \t")
+		if m == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(m, "=")
+		if !ok || !traceStateKey.MatchString(key) || !traceStateValue.MatchString(value) || seen[key] {
+			return false
+		}
+		seen[key] = true
+		members++
+	}
+	return members <= maxTraceStateMembers
+}
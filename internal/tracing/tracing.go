@@ -0,0 +1,275 @@
+// Package tracing records requests as spans of distributed traces. It reads
+// and passes on W3C Trace Context (traceparent and tracestate), makes a
+// server span for each request and, through Transport, a client span for
+// each outgoing one, and hands finished spans to an Exporter such as
+// OTLPExporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	mathrand "math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+)
+
+// Kind is a span's role, numbered as in OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// StatusCode is a span's outcome, numbered as in OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a span attribute. Value is a string, bool, int, int64 or
+// float64.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is a finished span as an Exporter sees it.
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	SpanContext   SpanContext
+	Parent        SpanID // zero for the root of a trace
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Exporter sends finished spans somewhere. Export is called once per
+// sampled span, from whichever goroutine ended it, and must not block.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Span is an operation in progress. Its methods are safe to call
+// concurrently, and do nothing on a nil Span.
+type Span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns what is passed on to the span's children.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttribute sets key, replacing any earlier value.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.data.Attributes {
+		if a.Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// SetStatus records the span's outcome. The message is kept only for
+// StatusError.
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = code
+	s.data.StatusMessage = ""
+	if code == StatusError {
+		s.data.StatusMessage = message
+	}
+}
+
+// End finishes the span and exports it if it is sampled. Later calls do
+// nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.SpanContext.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+type Options struct {
+	// Exporter receives sampled spans. With none, trace context is still
+	// passed on but nothing is recorded.
+	Exporter Exporter
+	// SampleRatio is the fraction of traces started here that are
+	// sampled. Zero, or anything over one, samples them all. Traces that
+	// arrive with a traceparent keep the caller's decision.
+	SampleRatio float64
+}
+
+type tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	random      func() float64
+}
+
+// start begins a span under parent, or a new trace if parent isn't valid.
+func (t *tracer) start(parent SpanContext, kind Kind, name string) *Span {
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		sc.TraceState = parent.TraceState
+	} else {
+		rand.Read(sc.TraceID[:])
+		sc.Sampled = t.sampleRatio <= 0 || t.sampleRatio >= 1 || t.random() < t.sampleRatio
+	}
+	return &Span{tracer: t, data: SpanData{
+		Name:        name,
+		Kind:        kind,
+		SpanContext: sc,
+		Parent:      parent.SpanID,
+		Start:       time.Now(),
+	}}
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+type contextKey struct{}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// ContextWithSpan returns ctx carrying s, for code that starts work of its
+// own under a request's span.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromRequest returns the server span the middleware made for req, or nil.
+func FromRequest(req *request.Request) *Span {
+	s, _ := req.Value(contextKey{}).(*Span)
+	return s
+}
+
+// Middleware gives each request a server span, continuing the trace in
+// its traceparent if it has a valid one. The span is named after the
+// method and the Mux route, and ends when the handler returns, or panics;
+// a 5xx, or no response at all, marks it as failed.
+func Middleware(opts Options) server.Middleware {
+	t := &tracer{exporter: opts.Exporter, sampleRatio: opts.SampleRatio, random: mathrand.Float64}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			method := req.RequestLine.Method
+			span := t.start(extract(req), KindServer, method)
+			span.SetAttribute("http.request.method", method)
+			span.SetAttribute("url.path", req.Path())
+			span.SetAttribute("network.protocol.version", req.RequestLine.HttpVersion)
+			span.SetAttribute("client.address", clientAddress(req.RemoteAddr))
+			if ua, ok := req.Headers.Get("User-Agent"); ok {
+				span.SetAttribute("user_agent.original", ua)
+			}
+			req.SetValue(contextKey{}, span)
+			// deferred, so that a handler panicking, which the server
+			// recovers from, still ends its span
+			defer func() {
+				if route := server.Route(req); route != "" {
+					span.SetName(method + " " + route)
+					span.SetAttribute("http.route", route)
+				}
+				code := w.Status()
+				if code != 0 {
+					span.SetAttribute("http.response.status_code", int(code))
+				}
+				switch {
+				case code == 0 || code >= 500:
+					span.SetStatus(StatusError, "")
+				case context.Cause(req.Context()) == server.ErrClientDisconnected:
+					span.SetStatus(StatusError, server.ErrClientDisconnected.Error())
+				}
+				span.End()
+			}()
+
+			next(w, req)
+		}
+	}
+}
+
+// extract reads the caller's span context from req, or returns the zero
+// SpanContext if it has none or a malformed one.
+func extract(req *request.Request) SpanContext {
+	v, ok := req.Headers.Get("traceparent")
+	if !ok {
+		return SpanContext{}
+	}
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		return SpanContext{}
+	}
+	// the headers package joins repeated tracestate fields with commas,
+	// which is how they combine anyway
+	if state, ok := req.Headers.Get("tracestate"); ok && ValidTraceState(state) {
+		sc.TraceState = state
+	}
+	return sc
+}
+
+func clientAddress(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"HTTPFTCP/internal/headers"
+	"HTTPFTCP/internal/request"
+	"HTTPFTCP/internal/response"
+	"HTTPFTCP/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is an Exporter that keeps spans in memory.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func attr(s SpanData, key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceparent(t *testing.T) {
+	// Test: The spec's example
+	sc, err := ParseTraceparent(parent)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, parent, sc.Traceparent())
+
+	// Test: Later versions are read as far as version 00 goes
+	sc, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-02-what-the-future-holds")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled)
+
+	// Test: Malformed values
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.",
+	} {
+		_, err := ParseTraceparent(v)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, v)
+	}
+
+	// Test: tracestate lists
+	assert.True(t, ValidTraceState("rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"))
+	assert.True(t, ValidTraceState("tenant@vendor=a b, ,x=1"))
+	assert.False(t, ValidTraceState("Rojo=1"))
+	assert.False(t, ValidTraceState("a=1,a=2"))
+	assert.False(t, ValidTraceState("a=b=c"))
+	assert.False(t, ValidTraceState("a=caf\u00e9"))
+	many := make([]string, 33)
+	for i := range many {
+		many[i] = "k" + strings.Repeat("x", i) + "=v"
+	}
+	assert.False(t, ValidTraceState(strings.Join(many, ",")))
+}
+
+func newRequest(method, target string, fields ...string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+		RemoteAddr:  "[2001:db8::1]:4711",
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		req.Headers.Set(fields[i], fields[i+1])
+	}
+	return req
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := &recorder{}
+	mux := server.NewMux()
+	var inner *Span
+	mux.Handle("GET", "/items/", func(w *response.Writer, req *request.Request) {
+		inner = FromRequest(req)
+		w.WriteStatusLine(response.StatusCodeInternalServerError)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	h := Middleware(Options{Exporter: rec})(mux.ServeRequest)
+
+	// Test: A request continues its caller's trace
+	_, w := response.NewRecorder()
+	h(w, newRequest("GET", "/items/7?x=1", "traceparent", parent, "tracestate", "rojo=1", "User-Agent", "test"))
+	require.Len(t, rec.spans, 1)
+	s := rec.spans[0]
+	assert.Equal(t, inner.SpanContext(), s.SpanContext)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", s.Parent.String())
+	assert.NotEqual(t, s.Parent, s.SpanContext.SpanID)
+	assert.Equal(t, "rojo=1", s.SpanContext.TraceState)
+	assert.Equal(t, KindServer, s.Kind)
+
+	// Test: It is named after its route and records the outcome
+	assert.Equal(t, "GET /items/", s.Name)
+	assert.Equal(t, "/items/", attr(s, "http.route"))
+	assert.Equal(t, "/items/7", attr(s, "url.path"))
+	assert.Equal(t, 500, attr(s, "http.response.status_code"))
+	assert.Equal(t, "2001:db8::1", attr(s, "client.address"))
+	assert.Equal(t, "test", attr(s, "user_agent.original"))
+	assert.Equal(t, StatusError, s.Status)
+	assert.False(t, s.End.Before(s.Start))
+
+	// Test: Without a valid traceparent a new trace starts
+	_, w = response.NewRecorder()
+	h(w, newRequest("POST", "/nowhere", "traceparent", "garbage", "tracestate", "rojo=1"))
+	require.Len(t, rec.spans, 2)
+	s = rec.spans[1]
+	assert.True(t, s.SpanContext.IsValid())
+	assert.False(t, s.Parent.IsValid())
+	assert.Empty(t, s.SpanContext.TraceState)
+	assert.Equal(t, "POST", s.Name)
+	assert.Equal(t, StatusUnset, s.Status)
+
+	// Test: A handler that panics still ends its span, as failed
+	mux.Handle("GET", "/panic", func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	})
+	_, w = response.NewRecorder()
+	assert.Panics(t, func() { h(w, newRequest("GET", "/panic")) })
+	require.Len(t, rec.spans, 3)
+	s = rec.spans[2]
+	assert.Equal(t, "GET /panic", s.Name)
+	assert.Equal(t, StatusError, s.Status)
+	assert.Nil(t, attr(s, "http.response.status_code"))
+
+	// Test: Callers that don't sample aren't recorded
+	_, w = response.NewRecorder()
+	h(w, newRequest("GET", "/items/1", "traceparent", strings.TrimSuffix(parent, "01")+"00"))
+	assert.Len(t, rec.spans, 3)
+	assert.False(t, inner.SpanContext().Sampled)
+
+	// Test: New traces are sampled at the configured ratio
+	sampled := &recorder{}
+	h = Middleware(Options{Exporter: sampled, SampleRatio: 0.25})(mux.ServeRequest)
+	for range 400 {
+		_, w = response.NewRecorder()
+		h(w, newRequest("GET", "/"))
+	}
+	assert.InDelta(t, 100, len(sampled.spans), 40)
+}
+
+func TestTransport(t *testing.T) {
+	got := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	rec := &recorder{}
+	h := Middleware(Options{Exporter: rec})(func(w *response.Writer, req *request.Request) {
+		upReq, err := http.NewRequestWithContext(req.Context(), "GET", upstream.URL+"/x", nil)
+		require.NoError(t, err)
+		upReq.Header.Set("tracestate", "stale=1")
+		resp, err := client.Do(upReq)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "stale=1", upReq.Header.Get("tracestate"))
+		w.WriteStatusLine(response.StatusCodeBadGateway)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+
+	// Test: Outgoing requests get a client span under the server span,
+	// and carry it on
+	_, w := response.NewRecorder()
+	h(w, newRequest("GET", "/", "traceparent", parent, "tracestate", "rojo=1"))
+	require.Len(t, rec.spans, 2)
+	clientSpan, serverSpan := rec.spans[0], rec.spans[1]
+	assert.Equal(t, KindClient, clientSpan.Kind)
+	assert.Equal(t, serverSpan.SpanContext.SpanID, clientSpan.Parent)
+	assert.Equal(t, serverSpan.SpanContext.TraceID, clientSpan.SpanContext.TraceID)
+	sent := <-got
+	assert.Equal(t, clientSpan.SpanContext.Traceparent(), sent.Get("traceparent"))
+	assert.Equal(t, "rojo=1", sent.Get("tracestate"))
+	assert.Equal(t, upstream.URL+"/x", attr(clientSpan, "url.full"))
+	assert.Equal(t, 404, attr(clientSpan, "http.response.status_code"))
+	assert.Equal(t, StatusError, clientSpan.Status)
+
+	// Test: Requests outside a trace are left alone
+	resp, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, (<-got).Get("traceparent"))
+	assert.Len(t, rec.spans, 2)
+}
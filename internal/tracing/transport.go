@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Transport is an http.RoundTripper that makes a client span for each
+// request whose context carries a span, such as one derived from a
+// request's Context under the middleware, and passes the trace on in
+// traceparent and tracestate. Requests without a span go straight
+// through. The span ends when the response headers arrive.
+type Transport struct {
+	// Base makes the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	parent := FromContext(req.Context())
+	if parent == nil {
+		return base.RoundTrip(req)
+	}
+
+	span := parent.tracer.start(parent.SpanContext(), KindClient, req.Method)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Hostname())
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		span.SetAttribute("server.port", port)
+	}
+	span.SetAttribute("url.full", redacted(req))
+	defer span.End()
+
+	// a RoundTripper mustn't change the request it was given
+	req = req.Clone(req.Context())
+	sc := span.SpanContext()
+	req.Header.Set("traceparent", sc.Traceparent())
+	req.Header.Del("tracestate")
+	if sc.TraceState != "" {
+		req.Header.Set("tracestate", sc.TraceState)
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetStatus(StatusError, err.Error())
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetStatus(StatusError, "")
+	}
+	return resp, nil
+}
+
+// redacted is req's URL without any credentials in it.
+func redacted(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}